@@ -0,0 +1,105 @@
+// Renders a service described in markdown into a static documentation
+// site that can be browsed offline:
+//
+//	pit-docs -out site -docs github.com/dockpit/pit-token=../pit-token/ ./docs
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dockpit/lang/parser"
+)
+
+// repeated 'id=url' flags
+type docsFlag map[string]string
+
+func (f docsFlag) String() string {
+	pairs := []string{}
+	for id, url := range f {
+		pairs = append(pairs, id+"="+url)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f docsFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected format '<dependency id>=<docs url>', got '%s'", s)
+	}
+
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// reads the cases of dependencies whose docs are a site next to the
+// output, so their cases are linked to their sections
+func docCases(out string, docs docsFlag) map[string]map[string]string {
+	cases := map[string]map[string]string{}
+	for id, doc := range docs {
+		u, err := url.Parse(doc)
+		if err != nil || u.Scheme != "" || u.Host != "" || path.IsAbs(u.Path) {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(u.Path), parser.SiteCasesFile))
+		if err != nil {
+			continue
+		}
+
+		m := map[string]string{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			fmt.Fprintf(os.Stderr, "cases of '%s' are not linked: %s\n", id, err)
+			continue
+		}
+
+		cases[id] = m
+	}
+
+	return cases
+}
+
+func main() {
+	docs := docsFlag{}
+	out := flag.String("out", "site", "directory the site is written to")
+	title := flag.String("title", "", "title of the pages, defaults to the name in the front matter")
+	flag.Var(docs, "docs", "documentation of a dependency as '<dependency id>=<docs url>', can be repeated")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	p := parser.NewMarkdown(dir)
+	data, diags := p.ParseAll()
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d)
+	}
+
+	if diags.Err() != nil {
+		os.Exit(1)
+	}
+
+	if *title == "" {
+		*title = data.Name
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil && *title == "" {
+		*title = filepath.Base(abs)
+	}
+
+	err := p.WriteSite(*out, parser.SiteOptions{Title: *title, Docs: docs, DocCases: docCases(*out, docs)})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,235 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The part of a response (or its side effects) an assertion failed on
+type Part string
+
+const (
+	PartStatus     = Part("status")
+	PartHeader     = Part("header")
+	PartBody       = Part("body")
+	PartDependency = Part("dependency")
+)
+
+// An assert error simply denotes the failure of an assert
+// during the test and the integrity of the program is fine. It
+// describes what was expected and what was received instead
+type AssertError struct {
+	Case string
+	Part Part
+
+	//the header name or dependency id the assertion was about
+	Key string
+
+	Expected string
+	Actual   string
+
+	//for bodies: differences by JSON path or a line diff
+	Diff string
+
+	Message string
+}
+
+func (e AssertError) Error() string {
+	msg := e.Message
+	if e.Case != "" {
+		msg = fmt.Sprintf("Case '%s': %s", e.Case, msg)
+	}
+
+	if e.Diff != "" {
+		msg += "\n" + e.Diff
+	}
+
+	return msg
+}
+
+// Describes how an actual body differs from the expected one. If both are
+// JSON each differing value is listed by its path (e.g $.users[0].id),
+// otherwise, or if they only differ in formatting, the lines are diffed
+func DiffBodies(exp, act []byte) string {
+	var v1, v2 interface{}
+	if json.Unmarshal(exp, &v1) == nil && json.Unmarshal(act, &v2) == nil {
+		diffs := diffJSON("$", v1, v2, []string{})
+		if len(diffs) > 0 {
+			return strings.Join(diffs, "\n")
+		}
+	}
+
+	if bytes.Equal(exp, act) {
+		return ""
+	}
+
+	return DiffLines(string(exp), string(act))
+}
+
+func encodeJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// lists the differences between two decoded JSON values
+func diffJSON(path string, exp, act interface{}, diffs []string) []string {
+	switch e := exp.(type) {
+	case map[string]interface{}:
+		a, ok := act.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := []string{}
+		for k := range e {
+			keys = append(keys, k)
+		}
+
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+
+		sort.Strings(keys)
+		for _, k := range keys {
+			kpath := path + "." + k
+			ev, eok := e[k]
+			av, aok := a[k]
+			switch {
+			case !aok:
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", kpath, encodeJSON(ev)))
+			case !eok:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", kpath, encodeJSON(av)))
+			default:
+				diffs = diffJSON(kpath, ev, av, diffs)
+			}
+		}
+
+		return diffs
+	case []interface{}:
+		a, ok := act.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(e) || i < len(a); i++ {
+			ipath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(a):
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", ipath, encodeJSON(e[i])))
+			case i >= len(e):
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", ipath, encodeJSON(a[i])))
+			default:
+				diffs = diffJSON(ipath, e[i], a[i], diffs)
+			}
+		}
+
+		return diffs
+	}
+
+	if !reflect.DeepEqual(exp, act) {
+		diffs = append(diffs, fmt.Sprintf("%s: expected %s, got %s", path, encodeJSON(exp), encodeJSON(act)))
+	}
+
+	return diffs
+}
+
+// The largest number of line pairs that are diffed, bigger texts are only
+// shown in part so a large body doesn't take up all memory
+const MaxDiffCells = 1 << 20
+
+// the lines of each text that are shown if they are too large to diff
+const maxUndiffedLines = 20
+
+// Returns a unified diff of two texts, without hunk headers: lines
+// only in exp start with '-', lines only in act with '+'
+func DiffLines(exp, act string) string {
+	a := strings.Split(exp, "\n")
+	b := strings.Split(act, "\n")
+
+	//lines both start and end with are the same for any diff
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	buf := bytes.NewBufferString("--- expected\n+++ actual\n")
+	for _, l := range a[:pre] {
+		fmt.Fprintf(buf, " %s\n", l)
+	}
+
+	end := b[len(b)-suf:]
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(a)*len(b) > MaxDiffCells {
+		writeUndiffed(buf, "-", a)
+		writeUndiffed(buf, "+", b)
+	} else {
+		writeDiff(buf, a, b)
+	}
+
+	for _, l := range end {
+		fmt.Fprintf(buf, " %s\n", l)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// writes the start of lines that are too many to diff
+func writeUndiffed(buf *bytes.Buffer, prefix string, lines []string) {
+	for i, l := range lines {
+		if i == maxUndiffedLines {
+			fmt.Fprintf(buf, "%s... %d more lines\n", prefix, len(lines)-i)
+			return
+		}
+
+		fmt.Fprintf(buf, "%s%s\n", prefix, l)
+	}
+}
+
+// writes the lines of a longest common subsequence diff
+func writeDiff(buf *bytes.Buffer, a, b []string) {
+
+	//longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(buf, " %s\n", a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			fmt.Fprintf(buf, "+%s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(buf, "-%s\n", a[i])
+			i++
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package manifest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestDiffBodies(t *testing.T) {
+
+	//json values by path
+	diff := DiffBodies(
+		[]byte(`{"id": "21", "name": "bob", "tags": ["a", "b"], "address": {"city": "Amsterdam"}}`),
+		[]byte(`{"id": 21, "tags": ["a"], "address": {"city": "Utrecht"}, "admin": true}`),
+	)
+
+	assert.Equal(t, `$.address.city: expected "Amsterdam", got "Utrecht"
+$.admin: unexpected true
+$.id: expected "21", got 21
+$.name: missing, expected "bob"
+$.tags[1]: missing, expected "b"`, diff)
+
+	//formatting differences are shown by line
+	diff = DiffBodies([]byte("{\"id\": \"21\"}"), []byte("{\"id\":\"21\"}"))
+	assert.Equal(t, "--- expected\n+++ actual\n-{\"id\": \"21\"}\n+{\"id\":\"21\"}", diff)
+
+	//text
+	diff = DiffBodies([]byte("a\nb\nc"), []byte("a\nc\nd"))
+	assert.Equal(t, "--- expected\n+++ actual\n a\n-b\n c\n+d", diff)
+
+	assert.Equal(t, "", DiffBodies([]byte("a"), []byte("a")))
+
+	//large texts are only shown in part, apart from the lines they share
+	exp, act := []string{"start"}, []string{"start"}
+	for i := 0; i < 2000; i++ {
+		exp = append(exp, fmt.Sprintf("e%d", i))
+		act = append(act, fmt.Sprintf("a%d", i))
+	}
+
+	diff = DiffLines(strings.Join(append(exp, "end"), "\n"), strings.Join(append(act, "end"), "\n"))
+	lines := strings.Split(diff, "\n")
+	assert.Len(t, lines, 2+1+21+21+1)
+	assert.Equal(t, " start", lines[2])
+	assert.Equal(t, "-... 1980 more lines", lines[23])
+	assert.Equal(t, "+a0", lines[24])
+	assert.Equal(t, " end", lines[45])
+}
+
+func TestAssertError(t *testing.T) {
+	err := AssertError{Case: "a user", Part: PartBody, Message: "Content Assertion: not equal", Diff: "$.id: expected 1, got 2"}
+	assert.Equal(t, "Case 'a user': Content Assertion: not equal\n$.id: expected 1, got 2", err.Error())
+}
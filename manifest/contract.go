@@ -14,8 +14,9 @@ func NewManifest(data *ManifestData) (*Manifest, error) {
 		cases := []*Pair{}
 		for _, c := range r.Cases {
 
-			//create pair from data
-			p, err := NewPairFromData(c, data)
+			//create pair from data, resources may define
+			//archetypes for all their cases
+			p, err := newPairFromData(c, r.Archetypes, data)
 			if err != nil {
 				return nil, err
 			}
@@ -23,7 +24,7 @@ func NewManifest(data *ManifestData) (*Manifest, error) {
 			cases = append(cases, p)
 		}
 
-		res = append(res, NewResource(r.Pattern, cases...))
+		res = append(res, NewResource(WithBasePath(data.BasePath, r.Pattern), cases...))
 	}
 
 	return &Manifest{name: data.Name, resources: res}, nil
@@ -65,7 +66,7 @@ func (c *Manifest) States() (map[string][]string, error) {
 					}
 
 					//@todo prevend duplicate snames?
-					states[pname] = append(states[pname], g.Name)
+					states[pname] = append(states[pname], g.States()...)
 
 				}
 			}
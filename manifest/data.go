@@ -2,17 +2,27 @@ package manifest
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/dockpit/assert/strategy"
 )
 
 type Given struct {
 	Name string `json:"name"`
+
+	//further states the provider is in at the same time
+	Others []string `json:"others,omitempty"`
+}
+
+// Returns every state the provider is given, the first is Name
+func (g Given) States() []string {
+	return append([]string{g.Name}, g.Others...)
 }
 
 type When struct {
 	Method  string      `json:"method"`
 	Path    string      `json:"path"`
+	Query   url.Values  `json:"query,omitempty"`
 	Headers http.Header `json:"headers"`
 	Body    string      `json:"body"`
 }
@@ -21,6 +31,18 @@ type Then struct {
 	Status     string      `json:"status"`
 	Headers    http.Header `json:"headers"`
 	Body       string      `json:"body"`
+
+	//accepted codes (e.g 2xx or 200|204), StatusCode is the first of them
+	StatusCodes []StatusRange `json:"codes,omitempty"`
+
+	//JSON path expectations (e.g '$.items length 3') and paths that
+	//are not compared with the example body (e.g '$.created_at')
+	Expect []string `json:"expect,omitempty"`
+	Ignore []string `json:"ignore,omitempty"`
+
+	//'at-least' (default) or 'strict', see HeaderMode
+	HeaderMode    string   `json:"header_mode,omitempty"`
+	IgnoreHeaders []string `json:"ignore_headers,omitempty"`
 }
 
 type While struct {
@@ -29,20 +51,43 @@ type While struct {
 }
 
 type ResourceData struct {
-	Pattern string      `json:"pattern"`
-	Cases   []*CaseData `json:"cases"`
+	Pattern    string                `json:"pattern"`
+	Cases      []*CaseData           `json:"cases"`
+	Archetypes []*strategy.Archetype `json:"archetypes,omitempty"`
+
+	//prose about the resource for people reading the manifest
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
 }
 
 type CaseData struct {
-	Name  string           `json:"name"`
-	Given map[string]Given `json:"given"`
-	When  When             `json:"when"`
-	Then  Then             `json:"then"`
-	While []While          `json:"while"`
+	Name    string           `json:"name"`
+	Given   map[string]Given `json:"given"`
+	When    When             `json:"when"`
+	Then    Then             `json:"then"`
+	While   []While          `json:"while"`
+	Timeout string           `json:"timeout,omitempty"`
+
+	//archetypes for this case only, see ScopeArchetypes
+	Archetypes []*strategy.Archetype `json:"archetypes,omitempty"`
+
+	//prose about the example, e.g the reasoning behind it
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
 }
 
 type ManifestData struct {
 	Name       string                `json:"name"`
+	Version    string                `json:"version,omitempty"`
+	Owners     []string              `json:"owners,omitempty"`
 	Resources  []*ResourceData       `json:"resources"`
 	Archetypes []*strategy.Archetype `json:"archetypes"`
+
+	//prefixed to every resource pattern and request path
+	BasePath string `json:"base_path,omitempty"`
+
+	//sent with every request, unless the case sets the header itself
+	Headers http.Header `json:"headers,omitempty"`
 }
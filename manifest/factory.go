@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"encoding/json"
+	"io"
 )
 
 type Factory struct{}
@@ -44,3 +45,10 @@ func (f *Factory) Load(loc string) (*ManifestData, error) {
 
 	return c, nil
 }
+
+// Writes manifest data as the JSON that Load reads
+func (f *Factory) Write(w io.Writer, data *ManifestData) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
@@ -118,3 +118,43 @@ func TestFactoryDraft(t *testing.T) {
 	assert.Equal(t, "application/html", pairs[0].Response.Header.Get("Content-Type"))
 
 }
+
+// test *ManifestData -> JSON -> *ManifestData
+func TestFactoryWriting(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFactory()
+	data, err := f.Load(filepath.Join(wd, "auth.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//prose is kept
+	data.Resources[0].Summary = "All users of the service"
+	data.Resources[0].Cases[0].Description = "Tokens are checked first.\n\nUsers are cached."
+	data.Resources[0].Cases[0].Tags = []string{"auth", "users"}
+
+	fpath := filepath.Join(os.TempDir(), "dockpit_factory_write.json")
+	defer os.Remove(fpath)
+
+	out, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Write(out, data)
+	out.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := f.Load(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, data, written)
+}
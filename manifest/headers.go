@@ -0,0 +1,289 @@
+package manifest
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// How the headers of a response are compared to the example
+type HeaderMode string
+
+const (
+
+	//the response has at least the headers of the example
+	HeadersAtLeast = HeaderMode("at-least")
+
+	//the response has exactly the headers of the example, apart from
+	//ignored and volatile headers
+	HeadersStrict = HeaderMode("strict")
+)
+
+// Headers that are set by servers or proxies and differ per response,
+// they are never compared in strict mode
+var VolatileHeaders = []string{"Date", "Content-Length", "Transfer-Encoding", "Connection"}
+
+// Example header values that start with one of these match values in
+// a different way, e.g: 'Location: @prefix: /users/' or 'Etag: @present'
+const (
+	MatchPresent = "@present"
+	MatchPrefix  = "@prefix:"
+	MatchRegex   = "@regex:"
+)
+
+// Matches actual header values against an example value
+type ValueMatcher struct {
+	raw   string
+	kind  string
+	value string
+	re    *regexp.Regexp
+}
+
+func ParseValueMatcher(expval string) (*ValueMatcher, error) {
+	switch {
+	case expval == MatchPresent:
+		return &ValueMatcher{raw: expval, kind: MatchPresent}, nil
+	case strings.HasPrefix(expval, MatchPrefix):
+		return &ValueMatcher{raw: expval, kind: MatchPrefix, value: strings.TrimSpace(expval[len(MatchPrefix):])}, nil
+	case strings.HasPrefix(expval, MatchRegex):
+		v := strings.TrimSpace(expval[len(MatchRegex):])
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid header matcher '%s': %s", expval, err)
+		}
+
+		return &ValueMatcher{raw: expval, kind: MatchRegex, value: v, re: re}, nil
+	}
+
+	return &ValueMatcher{raw: expval, value: expval}, nil
+}
+
+// the example value as written
+func (m *ValueMatcher) String() string {
+	return m.raw
+}
+
+func (m *ValueMatcher) Match(val string) bool {
+	switch m.kind {
+	case MatchPresent:
+		return true
+	case MatchPrefix:
+		return strings.HasPrefix(val, m.value)
+	case MatchRegex:
+		return m.re.MatchString(val)
+	}
+
+	return m.value == val
+}
+
+// Returns a value that matches, if there is an obvious one
+func (m *ValueMatcher) Example() (string, bool) {
+	switch m.kind {
+	case MatchPresent, MatchRegex:
+		return "", false
+	}
+
+	return m.value, true
+}
+
+// the value mocks respond with for '@present' headers
+const MockPresentValue = "mock"
+
+// Returns the value a mock responds with instead of the matcher itself,
+// there is none for a regular expression
+func (m *ValueMatcher) MockValue() (string, error) {
+	switch m.kind {
+	case MatchPresent:
+		return MockPresentValue, nil
+	case MatchRegex:
+		return "", fmt.Errorf("a mock can't respond with a value that matches '%s', expected a literal, '%s' or '%s' value", m.raw, MatchPresent, MatchPrefix)
+	}
+
+	return m.value, nil
+}
+
+// checks that a mock can respond with every header of the example
+func (p *Pair) mockHeaders() error {
+	matchers, err := parseHeaderMatchers(p.Response.Header)
+	if err != nil {
+		return err
+	}
+
+	for key, ms := range matchers {
+		for _, m := range ms {
+			if _, err := m.MockValue(); err != nil {
+				return MockingError(fmt.Sprintf("header '%s' of case '%s': %s", key, p.Name, err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// parses every value of the headers as a matcher
+func parseHeaderMatchers(h http.Header) (map[string][]*ValueMatcher, error) {
+	matchers := map[string][]*ValueMatcher{}
+	for key, expvals := range h {
+		for _, expval := range expvals {
+			m, err := ParseValueMatcher(expval)
+			if err != nil {
+				return nil, err
+			}
+
+			key = http.CanonicalHeaderKey(key)
+			matchers[key] = append(matchers[key], m)
+		}
+	}
+
+	return matchers, nil
+}
+
+// the value of an example header, if the example uses a matcher without
+// an obvious value the actual value is returned if it matches
+func (p *Pair) exampleHeader(key string, actual http.Header) string {
+	expval := p.Response.Header.Get(key)
+	m, err := ParseValueMatcher(expval)
+	if err != nil {
+		return ""
+	}
+
+	if ex, ok := m.Example(); ok {
+		return ex
+	}
+
+	if val := actual.Get(key); m.Match(val) {
+		return val
+	}
+
+	return ""
+}
+
+func containsHeader(keys []string, key string) bool {
+	for _, k := range keys {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Pair) ignoresHeader(key string) bool {
+	if p.HeaderMode == HeadersStrict && containsHeader(VolatileHeaders, key) {
+		return true
+	}
+
+	return containsHeader(p.IgnoreHeaders, key)
+}
+
+func joinMatchers(ms []*ValueMatcher) string {
+	vals := []string{}
+	for _, m := range ms {
+		vals = append(vals, m.String())
+	}
+
+	return strings.Join(vals, ", ")
+}
+
+// checks every header of the example against the actual headers, in
+// strict mode the actual headers may not include others
+func (p *Pair) assertHeaders(h http.Header) error {
+	matchers, err := parseHeaderMatchers(p.Response.Header)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{}
+	for key := range matchers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if p.ignoresHeader(key) {
+			continue
+		}
+
+		expvals := joinMatchers(matchers[key])
+		vals := h[key]
+		if len(vals) == 0 {
+			return AssertError{
+				Case:     p.Name,
+				Part:     PartHeader,
+				Key:      key,
+				Expected: expvals,
+				Message:  fmt.Sprintf("Expected response with '%s' header", key),
+			}
+		}
+
+		//strict: each value matches the example value at the same position
+		if p.HeaderMode == HeadersStrict {
+			ok := len(vals) == len(matchers[key])
+			for i := 0; ok && i < len(vals); i++ {
+				ok = matchers[key][i].Match(vals[i])
+			}
+
+			if !ok {
+				return AssertError{
+					Case:     p.Name,
+					Part:     PartHeader,
+					Key:      key,
+					Expected: expvals,
+					Actual:   strings.Join(vals, ", "),
+					Message:  fmt.Sprintf("Expected '%s' header to have the values [%s], received: %v", key, expvals, vals),
+				}
+			}
+
+			continue
+		}
+
+		//at least: every example value matches one of the values
+		for _, m := range matchers[key] {
+			matched := false
+			for _, val := range vals {
+				if m.Match(val) {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return AssertError{
+					Case:     p.Name,
+					Part:     PartHeader,
+					Key:      key,
+					Expected: m.String(),
+					Actual:   strings.Join(vals, ", "),
+					Message:  fmt.Sprintf("Expected '%s' header to have a value that matches '%s', received: %v", key, m, vals),
+				}
+			}
+		}
+	}
+
+	if p.HeaderMode != HeadersStrict {
+		return nil
+	}
+
+	//strict: no other headers
+	unexpected := []string{}
+	for key := range h {
+		if _, ok := matchers[http.CanonicalHeaderKey(key)]; !ok && !p.ignoresHeader(key) {
+			unexpected = append(unexpected, key)
+		}
+	}
+
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		return AssertError{
+			Case:    p.Name,
+			Part:    PartHeader,
+			Key:     unexpected[0],
+			Actual:  h.Get(unexpected[0]),
+			Message: fmt.Sprintf("Unexpected response headers: %s", strings.Join(unexpected, ", ")),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package manifest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestHeaderMatching(t *testing.T) {
+	p, err := NewPairFromData(&CaseData{
+		Name: "created user",
+		When: When{Method: "POST", Path: "/users"},
+		Then: Then{StatusCode: 201, Headers: http.Header{
+			"Encoding":     []string{"gzip"},
+			"X-Version":    []string{"2"},
+			"Location":     []string{"@prefix: /users/"},
+			"Etag":         []string{"@present"},
+			"X-Request-Id": []string{"@regex: ^[a-f0-9]{8}$"},
+		}},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := func(h http.Header) *http.Response {
+		for key, vals := range map[string]string{"Encoding": "gzip", "X-Version": "2", "Location": "/users/21", "Etag": "abc", "X-Request-Id": "0a1b2c3d"} {
+			if h.Get(key) == "" {
+				h.Set(key, vals)
+			}
+		}
+
+		return &http.Response{StatusCode: 201, Header: h}
+	}
+
+	assert.NoError(t, p.IsExpectedResponse(actual(http.Header{"Date": []string{"now"}})))
+
+	//every header is checked, not just the first
+	for key, val := range map[string]string{"X-Version": "3", "Location": "/notes/21", "X-Request-Id": "xyz"} {
+		err = p.IsExpectedResponse(actual(http.Header{key: []string{val}}))
+		if aerr, ok := err.(AssertError); assert.True(t, ok, key) {
+			assert.Equal(t, PartHeader, aerr.Part)
+			assert.Equal(t, key, aerr.Key)
+			assert.Equal(t, val, aerr.Actual)
+		}
+	}
+
+	//strict mode doesn't allow other headers, unless ignored
+	p.HeaderMode = HeadersStrict
+	assert.NoError(t, p.IsExpectedResponse(actual(http.Header{"Date": []string{"now"}})))
+	assert.Error(t, p.IsExpectedResponse(actual(http.Header{"X-Cache": []string{"HIT"}})))
+
+	p.IgnoreHeaders = []string{"x-cache"}
+	assert.NoError(t, p.IsExpectedResponse(actual(http.Header{"X-Cache": []string{"HIT"}})))
+
+	//every example value has to match one of the values
+	p.HeaderMode = HeadersAtLeast
+	p.Response.Header["Set-Cookie"] = []string{"@prefix: session=", "@prefix: theme="}
+	assert.NoError(t, p.IsExpectedResponse(actual(http.Header{"Set-Cookie": []string{"theme=dark", "session=1"}})))
+	err = p.IsExpectedResponse(actual(http.Header{"Set-Cookie": []string{"session=1", "lang=en"}}))
+	if aerr, ok := err.(AssertError); assert.True(t, ok) {
+		assert.Equal(t, "Set-Cookie", aerr.Key)
+		assert.Equal(t, "@prefix: theme=", aerr.Expected)
+	}
+
+	//mocks respond with a value that matches
+	rec := httptest.NewRecorder()
+	p.GenerateHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+	assert.Equal(t, "/users/", rec.Header().Get("Location"))
+	assert.Equal(t, MockPresentValue, rec.Header().Get("Etag"))
+
+	//but can't for a regular expression
+	m, err := NewManifest(&ManifestData{Resources: []*ResourceData{{Pattern: "/users", Cases: []*CaseData{{
+		Name: "created user",
+		When: When{Method: "POST", Path: "/users"},
+		Then: Then{StatusCode: 201, Headers: http.Header{"X-Request-Id": []string{"@regex: ^[a-f0-9]{8}$"}}},
+	}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Handler()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "X-Request-Id")
+	}
+
+	//invalid matchers and modes are reported
+	_, err = NewPairFromData(&CaseData{Name: "A", When: When{Method: "GET", Path: "/"}, Then: Then{Headers: http.Header{"Etag": []string{"@regex: ("}}}}, &ManifestData{})
+	assert.Error(t, err)
+
+	_, err = NewPairFromData(&CaseData{Name: "A", When: When{Method: "GET", Path: "/"}, Then: Then{HeaderMode: "loose"}}, &ManifestData{})
+	assert.Error(t, err)
+}
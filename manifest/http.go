@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,7 +10,9 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zenazn/goji/web"
 
@@ -18,39 +21,197 @@ import (
 	"github.com/dockpit/pit/config"
 )
 
-// An assert error simply denotes the failure of an assert
-// during the test and the integrity of the program is fine
-type AssertError struct{ err string }
+// A pair of an example request and response. The bodies are kept as
+// bytes and never read from the request or response so a pair can serve
+// and test any number of times, concurrently
+type Pair struct {
+	Name         string
+	Request      *http.Request
+	Response     *http.Response
+	RequestBody  []byte
+	ResponseBody []byte
+	While        []While
+	Given        map[string]Given
+	Archetypes   []*strategy.Archetype
+
+	//the maximum duration of a test run, zero means no limit
+	Timeout time.Duration
+
+	//how response headers are compared, at-least by default
+	HeaderMode    HeaderMode
+	IgnoreHeaders []string
+
+	//the accepted status codes, if empty only the code of the response
+	StatusCodes []StatusRange
+
+	//checks of body fields in addition to the example body and
+	//fields that are not compared with the example
+	Expect []*Expectation
+	Ignore []*JSONPath
+}
 
-func (e AssertError) Error() string { return e.err }
+// Creates a pair by reading the bodies of the example request and
+// response once, they are replaced so the caller can still read them
+func NewPair(name string, req *http.Request, resp *http.Response, while []While, given map[string]Given, archetypes []*strategy.Archetype) (*Pair, error) {
+	reqb, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
 
-type Pair struct {
-	Name       string
-	Request    *http.Request
-	Response   *http.Response
-	While      []While
-	Given      map[string]Given
-	Archetypes []*strategy.Archetype
+	respb, err := drainBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	//header values may be matchers
+	_, err = parseHeaderMatchers(resp.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pair{
+		Name:         name,
+		Request:      req,
+		Response:     resp,
+		RequestBody:  reqb,
+		ResponseBody: respb,
+		While:        while,
+		Given:        given,
+		Archetypes:   archetypes,
+	}, nil
+}
+
+// reads a body and replaces it with a reader over the same content
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return []byte{}, nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
 }
 
 func NewPairFromData(data *CaseData, cdata *ManifestData) (*Pair, error) {
+	return newPairFromData(data, nil, cdata)
+}
+
+// creates a pair of a case in a resource, the archetypes of the case, the
+// resource and the manifest are scoped in that order
+func newPairFromData(data *CaseData, rarchetypes []*strategy.Archetype, cdata *ManifestData) (*Pair, error) {
+
+	//the path may contain a query (older manifests) that
+	//is extended by the structured query
+	u, err := url.Parse(data.When.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.When.Query) > 0 {
+		q := u.Query()
+		for key, vals := range data.When.Query {
+			for _, val := range vals {
+				q.Add(key, val)
+			}
+		}
+
+		u.RawQuery = q.Encode()
+	}
+
+	//paths are relative to the base path of the manifest
+	u.Path = WithBasePath(cdata.BasePath, u.Path)
 
 	//create request from data
-	req, err := http.NewRequest(data.When.Method, data.When.Path, strings.NewReader(data.When.Body))
+	req, err := http.NewRequest(data.When.Method, u.String(), strings.NewReader(data.When.Body))
 	if err != nil {
 		return nil, err
 	}
 
-	//add headers to request
+	//add headers to request, those of the case
+	//take precedence over the manifest defaults
 	req.Header = data.When.Headers
+	if len(cdata.Headers) > 0 {
+		req.Header = http.Header{}
+		for key, vals := range cdata.Headers {
+			req.Header[key] = vals
+		}
+
+		for key, vals := range data.When.Headers {
+			req.Header[key] = vals
+		}
+	}
 
 	//create expected response from data
 	resp := &http.Response{}
 	resp.StatusCode = data.Then.StatusCode
+	if resp.StatusCode == 0 && len(data.Then.StatusCodes) > 0 {
+		resp.StatusCode = data.Then.StatusCodes[0].Code()
+	}
 	resp.Body = ioutil.NopCloser(strings.NewReader(data.Then.Body))
 	resp.Header = data.Then.Headers
 
-	return &Pair{data.Name, req, resp, data.While, data.Given, cdata.Archetypes}, nil
+	p, err := NewPair(data.Name, req, resp, data.While, data.Given, ScopeArchetypes(data.Archetypes, rarchetypes, cdata.Archetypes))
+	if err != nil {
+		return nil, err
+	}
+
+	switch HeaderMode(data.Then.HeaderMode) {
+	case "", HeadersAtLeast, HeadersStrict:
+		p.HeaderMode = HeaderMode(data.Then.HeaderMode)
+	default:
+		return nil, fmt.Errorf("Invalid header mode for case '%s': '%s', expected '%s' or '%s'", data.Name, data.Then.HeaderMode, HeadersAtLeast, HeadersStrict)
+	}
+
+	p.IgnoreHeaders = data.Then.IgnoreHeaders
+	p.StatusCodes = data.Then.StatusCodes
+	for _, exp := range data.Then.Expect {
+		e, err := ParseExpectation(exp)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expectation for case '%s': %s", data.Name, err)
+		}
+
+		p.Expect = append(p.Expect, e)
+	}
+
+	for _, ign := range data.Then.Ignore {
+		path, err := ParseJSONPath(ign)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ignored path for case '%s': %s", data.Name, err)
+		}
+
+		p.Ignore = append(p.Ignore, path)
+	}
+
+	if data.Timeout != "" {
+		p.Timeout, err = time.ParseDuration(data.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout for case '%s': %s", data.Name, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Prefixes a path (or resource pattern) with the base path of a manifest
+func WithBasePath(base, p string) string {
+	return strings.TrimRight(base, "/") + p
+}
+
+// Combines archetypes of nested scopes (e.g case, resource and manifest),
+// archetypes of inner scopes come first so they are tried before and
+// take precedence over those of outer scopes
+func ScopeArchetypes(scopes ...[]*strategy.Archetype) []*strategy.Archetype {
+	var archetypes []*strategy.Archetype
+	for _, scope := range scopes {
+		archetypes = append(archetypes, scope...)
+	}
+
+	return archetypes
 }
 
 func (p *Pair) BelongsToAction(a A) bool {
@@ -64,134 +225,142 @@ func (p *Pair) BelongsToAction(a A) bool {
 }
 
 func (p *Pair) IsExpectedResponse(resp *http.Response) error {
-	var err error
+	//expected content
+	c1 := p.ResponseBody
 
-	//get expected content
-	c1 := []byte{}
-	if p.Response.Body != nil {
-		buff := bytes.NewBuffer(nil)
-		r := io.TeeReader(p.Response.Body, buff)
+	//get actual content, without consuming it
+	c2, err := drainBody(&resp.Body)
+	if err != nil {
+		return err
+	}
 
-		c1, err = ioutil.ReadAll(r)
-		if err != nil {
-			return err
+	//assert response code
+	if !p.ExpectsStatus(resp.StatusCode) {
+		return AssertError{
+			Case:     p.Name,
+			Part:     PartStatus,
+			Expected: p.expectedStatus(),
+			Actual:   strconv.Itoa(resp.StatusCode),
+			Message:  fmt.Sprintf("StatusCode not equal, expected '%s' but got '%d' with content: '%s'", p.expectedStatus(), resp.StatusCode, string(c2)),
 		}
-
-		p.Response.Body = ioutil.NopCloser(buff)
 	}
 
-	//get actualy content
-	c2 := []byte{}
-	if resp.Body != nil {
-		buff := bytes.NewBuffer(nil)
-		r := io.TeeReader(resp.Body, buff)
+	//responses to HEAD requests have no body to assert
+	if p.Request.Method != "HEAD" {
 
-		c2, err = ioutil.ReadAll(r)
-		if err != nil {
-			return err
+		//determine content mime type by looking at the example body
+		//but if a content-type is set specifically overwrite this
+		mimet := http.DetectContentType(c1)
+		if ct := p.exampleHeader("Content-Type", resp.Header); ct != "" {
+			mimet, _, err = mime.ParseMediaType(ct)
+			if err != nil {
+				return err
+			}
 		}
 
-		resp.Body = ioutil.NopCloser(buff)
-	}
+		//create parser using mimetype
+		parser := assert.Parser(mimet, p.Archetypes)
 
-	//assert response code
-	if p.Response.StatusCode != resp.StatusCode {
-		return AssertError{fmt.Sprintf("StatusCode not equal, expected '%d' but got '%d' with content: '%s'", p.Response.StatusCode, resp.StatusCode, string(c2))}
-	}
+		//assert if content follows the example, apart from ignored fields
+		exp, act := p.withoutIgnored(c1, c2)
+		err = assert.Follows(exp, act, parser)
+		if err != nil {
+			return AssertError{
+				Case:     p.Name,
+				Part:     PartBody,
+				Expected: string(exp),
+				Actual:   string(act),
+				Diff:     DiffBodies(exp, act),
+				Message:  fmt.Sprintf("Content Assertion: %s\n Archetypes: %v", err, p.Archetypes),
+			}
+		}
 
-	//determine content mime type by looking at the example body
-	//but if a content-type is set specifically overwrite this
-	mimet := http.DetectContentType(c1)
-	if ct := p.Response.Header.Get("Content-Type"); ct != "" {
-		mimet, _, err = mime.ParseMediaType(ct)
+		//and check field expectations
+		err = p.assertFields(c2)
 		if err != nil {
 			return err
 		}
 	}
 
-	//create parser using mimetype
-	parser := assert.Parser(mimet, p.Archetypes)
+	//check the expected headers
+	return p.assertHeaders(resp.Header)
+}
 
-	//assert if content follows the example
-	err = assert.Follows(c1, c2, parser)
+func (p *Pair) IsSuccessLike() bool {
+	return p.Response.StatusCode >= 200 && p.Response.StatusCode < 300
+}
+
+// Creates a new request from the example that is send to the given host, each
+// request has its own copy of the url, headers and a fresh body
+func (p *Pair) NewRequest(host string) (*http.Request, error) {
+	h, err := url.Parse(host)
 	if err != nil {
-		return AssertError{fmt.Sprintf("Content Assertion: %s\n Archetypes: %s", err, p.Archetypes)}
+		return nil, err
 	}
 
-	//check if resp has _at least_ the expected headers
-	//@todo switch from _at teast_ to (strict) equal for consitency with content assertion
-ExpVals:
-	for key, expvals := range p.Response.Header {
-		val := resp.Header.Get(key)
-		if val == "" {
-			return AssertError{fmt.Sprintf("Expected response with '%s' header", key)}
-		}
-
-		for _, expval := range expvals {
-			if expval == val {
-				break ExpVals
-			}
-		}
+	u := *p.Request.URL
+	u.Host = h.Host
+	u.Scheme = h.Scheme
 
-		//not any of the expected values
-		return AssertError{fmt.Sprintf("Expected '%s' header to have one of the following values: %s, received: %s", key, expvals, val)}
+	req, err := http.NewRequest(p.Request.Method, u.String(), bytes.NewReader(p.RequestBody))
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	for key, vals := range p.Request.Header {
+		req.Header[key] = append([]string(nil), vals...)
+	}
 
-func (p *Pair) IsSuccessLike() bool {
-	return p.Response.StatusCode >= 200 && p.Response.StatusCode < 300
+	return req, nil
 }
 
 func (p *Pair) GenerateHandler() web.Handler {
 	return web.HandlerFunc(func(ctx web.C, w http.ResponseWriter, r *http.Request) {
 
-		//add headers
+		//add headers, matchers are replaced by a matching value
 		for key, vals := range p.Response.Header {
 			for _, val := range vals {
-				w.Header().Add(key, val)
+				if m, err := ParseValueMatcher(val); err == nil {
+					if mval, err := m.MockValue(); err == nil {
+						w.Header().Add(key, mval)
+					}
+				}
 			}
 		}
 
 		//write status code and headers
 		w.WriteHeader(p.Response.StatusCode)
 
-		//copy body without consuming the original
-		if p.Response.Body != nil {
-			buff := bytes.NewBuffer(nil)
-			r := io.TeeReader(p.Response.Body, buff)
-			io.Copy(w, r)
-
-			//'reset' original response body
-			p.Response.Body = ioutil.NopCloser(buff)
+		//HEAD responses never have a body
+		if r.Method != "HEAD" && p.Request.Method != "HEAD" {
+			w.Write(p.ResponseBody)
 		}
 
 	})
 }
 
 func (p *Pair) GenerateTest() TestFunc {
-	return func(host, dhost string, client *http.Client, conf config.C) error {
-
-		//copy request from example pair
-		req := *p.Request
+	return func(ctx context.Context, host, dhost string, client *http.Client, conf config.C) error {
+		if p.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+			defer cancel()
+		}
 
-		//parse overwrite host url
-		h, err := url.Parse(host)
+		//create a request from the example for this run
+		req, err := p.NewRequest(host)
 		if err != nil {
 			return err
 		}
 
-		//overwrite generated with test specific host/scheme
-		req.URL.Host = h.Host
-		req.URL.Scheme = h.Scheme
-
 		//do the actual request
-		resp, err := client.Do(&req)
+		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
 			return err
 		}
 
+		defer resp.Body.Close()
+
 		//let the pair assert itself
 		if err := p.IsExpectedResponse(resp); err != nil {
 			return err
@@ -200,6 +369,9 @@ func (p *Pair) GenerateTest() TestFunc {
 		//ask each mocked dependency if it was called
 		for _, while := range p.While {
 			ports := conf.PortsForDependency(while.ID)
+			if len(ports) == 0 {
+				return fmt.Errorf("No ports configured for dependency '%s'", while.ID)
+			}
 
 			//parse host and form endpoint to get recordings from
 			dhosturl, err := url.Parse(dhost)
@@ -221,16 +393,33 @@ func (p *Pair) GenerateTest() TestFunc {
 			}
 
 			//request actual recording
-			recresp, err := http.Get(recurl.String())
+			recreq, err := http.NewRequest("GET", recurl.String(), nil)
+			if err != nil {
+				return err
+			}
+
+			recresp, err := client.Do(recreq.WithContext(ctx))
 			if err != nil {
 
+				//cancelled or timed out
+				if ctx.Err() != nil {
+					return err
+				}
+
 				//cant connect to mock?
 				return fmt.Errorf("Error while attempt to request dependency: '%s', are the mocks running?", err.Error())
 			}
 
+			defer recresp.Body.Close()
+
 			//receiving something else then 200 is probably bad
 			if recresp.StatusCode > 200 {
-				return AssertError{fmt.Sprintf("Mock %s recording doesn't have data case %s, returned: %d", while.ID, while.Case, recresp.StatusCode)}
+				return AssertError{
+					Case:    p.Name,
+					Part:    PartDependency,
+					Key:     while.ID,
+					Message: fmt.Sprintf("Mock %s recording doesn't have data case %s, returned: %d", while.ID, while.Case, recresp.StatusCode),
+				}
 			}
 
 			//decode to get information
@@ -243,7 +432,14 @@ func (p *Pair) GenerateTest() TestFunc {
 
 			//count mock
 			if rec.Count < 1 {
-				return AssertError{fmt.Sprintf("Mock %s expected case %s to have been called", while.ID, while.Case)}
+				return AssertError{
+					Case:     p.Name,
+					Part:     PartDependency,
+					Key:      while.ID,
+					Expected: "called",
+					Actual:   "not called",
+					Message:  fmt.Sprintf("Mock %s expected case %s to have been called", while.ID, while.Case),
+				}
 			}
 		}
 
@@ -255,8 +451,9 @@ func (p *Pair) GenerateTest() TestFunc {
 //
 //
 type Action struct {
-	pairs  []*Pair
-	method string
+	pairs   []*Pair
+	method  string
+	pattern string
 }
 
 func NewAction(p *Pair) *Action {
@@ -288,28 +485,28 @@ func (a *Action) Tests() []TestFunc {
 	return tests
 }
 
-//@todo this is deceprated
+// Returns a handler that responds with the example that best matches the
+// request (see Match), requests that match no example receive a 501
 func (a *Action) Handler(r *http.Request) (web.Handler, error) {
+	return web.HandlerFunc(func(c web.C, w http.ResponseWriter, r *http.Request) {
+		ex, cands, err := a.Match(r, c.URLParams)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if r != nil {
-		//@todo use the request for more sophistication?
-	}
-
-	//pick the first example that specified a success like response
-	var ex *Pair
-	for _, p := range a.pairs {
-		if p.IsSuccessLike() {
-			ex = p
-			break
+		if ex == nil {
+			writeNoMatch(w, r, cands)
+			return
 		}
-	}
 
-	if ex == nil {
-		return nil, MockingError(fmt.Sprintf("%s Action has no 'success-like' example", a.method))
-	}
+		//let routers know which example responded
+		if c.Env != nil {
+			c.Env[CaseEnvKey] = ex.Name
+		}
 
-	//return a handler that simply returns the example
-	return ex.GenerateHandler(), nil
+		ex.GenerateHandler().ServeHTTPC(c, w, r)
+	}), nil
 }
 
 //
@@ -345,7 +542,9 @@ Cases:
 		}
 
 		//no existing action was matched, create new one from pair
-		actions = append(actions, NewAction(pair))
+		a := NewAction(pair)
+		a.pattern = r.pattern
+		actions = append(actions, a)
 	}
 
 	return actions, nil
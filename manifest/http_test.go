@@ -1,12 +1,16 @@
 package manifest_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -33,16 +37,26 @@ var resp_userC = &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.
 var req_userD, _ = http.NewRequest("POST", "/users/13", nil)
 var resp_userD = &http.Response{StatusCode: 201, Header: http.Header{"Encoding": []string{"gzip"}}}
 
+// creates pairs from the example requests and responses above
+func newPair(name string, req *http.Request, resp *http.Response) *Pair {
+	p, err := NewPair(name, req, resp, []While{}, map[string]Given{}, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
 func TestMapping(t *testing.T) {
 	var r R
 
 	//given a set of http cases
 	r = NewResource(
 		"/users/:user_id",
-		&Pair{"A", req_userA, resp_userA, []While{}, map[string]Given{}, nil},
-		&Pair{"B", req_userB, resp_userB, []While{}, map[string]Given{}, nil},
-		&Pair{"C", req_userC, resp_userC, []While{}, map[string]Given{}, nil},
-		&Pair{"D", req_userD, resp_userD, []While{}, map[string]Given{}, nil},
+		newPair("A", req_userA, resp_userA),
+		newPair("B", req_userB, resp_userB),
+		newPair("C", req_userC, resp_userC),
+		newPair("D", req_userD, resp_userD),
 	)
 
 	assert.Equal(t, "/users/:user_id", r.Pattern())
@@ -53,10 +67,10 @@ func TestHandler(t *testing.T) {
 	//given a set of http cases
 	r := NewResource(
 		"/users/:user_id",
-		&Pair{"A", req_userA, resp_userA, []While{}, map[string]Given{}, nil},
-		&Pair{"B", req_userB, resp_userB, []While{}, map[string]Given{}, nil},
-		&Pair{"C", req_userC, resp_userC, []While{}, map[string]Given{}, nil},
-		&Pair{"D", req_userD, resp_userD, []While{}, map[string]Given{}, nil},
+		newPair("A", req_userA, resp_userA),
+		newPair("B", req_userB, resp_userB),
+		newPair("C", req_userC, resp_userC),
+		newPair("D", req_userD, resp_userD),
 	)
 
 	// get actions
@@ -96,10 +110,10 @@ func TestHandlerContent(t *testing.T) {
 	//given a set of http cases
 	r := NewResource(
 		"/users/:user_id",
-		&Pair{"A", req_userA, resp_userA, []While{}, map[string]Given{}, nil},
-		&Pair{"B", req_userB, resp_userB, []While{}, map[string]Given{}, nil},
-		&Pair{"C", req_userC, resp_userC, []While{}, map[string]Given{}, nil},
-		&Pair{"D", req_userD, resp_userD, []While{}, map[string]Given{}, nil},
+		newPair("A", req_userA, resp_userA),
+		newPair("B", req_userB, resp_userB),
+		newPair("C", req_userC, resp_userC),
+		newPair("D", req_userD, resp_userD),
 	)
 
 	// get actions
@@ -135,10 +149,10 @@ func TestTests(t *testing.T) {
 	//given a set of http cases
 	r := NewResource(
 		"/users/:user_id",
-		&Pair{"A", req_userA, resp_userA, []While{}, map[string]Given{}, nil},
-		&Pair{"B", req_userB, resp_userB, []While{}, map[string]Given{}, nil},
-		&Pair{"C", req_userC, resp_userC, []While{}, map[string]Given{}, nil},
-		&Pair{"D", req_userD, resp_userD, []While{}, map[string]Given{}, nil},
+		newPair("A", req_userA, resp_userA),
+		newPair("B", req_userB, resp_userB),
+		newPair("C", req_userC, resp_userC),
+		newPair("D", req_userD, resp_userD),
 	)
 
 	// get actions
@@ -160,7 +174,7 @@ func TestTests(t *testing.T) {
 		w.WriteHeader(201)
 	}))
 
-	err = ts[0](success.URL, "localhost", http.DefaultClient, empty_test_conf)
+	err = ts[0](context.Background(), success.URL, "localhost", http.DefaultClient, empty_test_conf)
 	assert.Equal(t, nil, err)
 
 	//failing test
@@ -168,7 +182,7 @@ func TestTests(t *testing.T) {
 		w.WriteHeader(200)
 	}))
 
-	err = ts[0](failing.URL, "localhost", http.DefaultClient, empty_test_conf)
+	err = ts[0](context.Background(), failing.URL, "localhost", http.DefaultClient, empty_test_conf)
 	assert.NotEqual(t, nil, err)
 
 }
@@ -178,9 +192,9 @@ func TestTestsContent(t *testing.T) {
 	//given a set of http cases
 	r := NewResource(
 		"/users/:user_id",
-		&Pair{"A", req_userB, resp_userB, []While{}, map[string]Given{}, nil},
-		&Pair{"B", req_userC, resp_userC, []While{}, map[string]Given{}, nil},
-		&Pair{"C", req_userD, resp_userD, []While{}, map[string]Given{}, nil},
+		newPair("A", req_userB, resp_userB),
+		newPair("B", req_userC, resp_userC),
+		newPair("C", req_userD, resp_userD),
 	)
 
 	// get actions
@@ -201,7 +215,7 @@ func TestTestsContent(t *testing.T) {
 		fmt.Fprint(w, `{"id": "11"}`+"\n")
 	}))
 
-	err = ts[0](success.URL, "localhost", http.DefaultClient, empty_test_conf)
+	err = ts[0](context.Background(), success.URL, "localhost", http.DefaultClient, empty_test_conf)
 	assert.Equal(t, nil, err)
 
 	//failing test
@@ -210,7 +224,221 @@ func TestTestsContent(t *testing.T) {
 		fmt.Fprint(w, `{"id":"11"}`+"\n") //very strict byte by byte check
 	}))
 
-	err = ts[0](failing.URL, "localhost", http.DefaultClient, empty_test_conf)
+	err = ts[0](context.Background(), failing.URL, "localhost", http.DefaultClient, empty_test_conf)
 	assert.NotEqual(t, nil, err)
 
+	//failure describes the difference
+	aerr, ok := err.(AssertError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "A", aerr.Case)
+		assert.Equal(t, PartBody, aerr.Part)
+		assert.Equal(t, `{"id": "11"}`, aerr.Expected)
+		assert.Contains(t, aerr.Diff, "-{\"id\": \"11\"}\n+{\"id\":\"11\"}")
+	}
+
+}
+
+func TestHeadAction(t *testing.T) {
+	req, _ := http.NewRequest("HEAD", "/users/21", nil)
+	resp := &http.Response{StatusCode: 200, Header: http.Header{"Etag": []string{"abc"}}, Body: ioutil.NopCloser(strings.NewReader(`{"id": "21"}`))}
+
+	r := NewResource("/users/:user_id", newPair("A", req, resp))
+	as, err := r.Actions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "HEAD", as[0].Method())
+
+	//mock should not write a body
+	h, err := as[0].Handler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "abc", rec.Header().Get("Etag"))
+	assert.Equal(t, "", rec.Body.String())
+
+	//test should not assert a body
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", "abc")
+		w.WriteHeader(200)
+	}))
+
+	err = as[0].Tests()[0](context.Background(), svr.URL, "localhost", http.DefaultClient, empty_test_conf)
+	assert.Equal(t, nil, err)
+}
+
+func TestQueryHandler(t *testing.T) {
+	all, err := NewPairFromData(&CaseData{
+		Name: "list of notes",
+		When: When{Method: "GET", Path: "/notes"},
+		Then: Then{StatusCode: 200, Body: `[{"id": "1"}, {"id": "2"}]`},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered, err := NewPairFromData(&CaseData{
+		Name: "filtered list of notes",
+		When: When{Method: "GET", Path: "/notes", Query: url.Values{"author": []string{"1"}}},
+		Then: Then{StatusCode: 200, Body: `[{"id": "1"}]`},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	as, err := NewResource("/notes", filtered, all).Actions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := as[0].Handler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//mock should pick the case by query
+	for q, exp := range map[string]string{"": `[{"id": "1"}, {"id": "2"}]`, "?author=1": `[{"id": "1"}]`, "?author=2": `[{"id": "1"}, {"id": "2"}]`} {
+		req, _ := http.NewRequest("GET", "/notes"+q, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, exp, rec.Body.String())
+	}
+
+	//test should send the query
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("author"))
+		fmt.Fprint(w, `[{"id": "1"}]`)
+	}))
+
+	err = filtered.GenerateTest()(context.Background(), svr.URL, "localhost", http.DefaultClient, empty_test_conf)
+	assert.Equal(t, nil, err)
+}
+
+func TestPairConcurrent(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"name": "bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := &http.Response{StatusCode: 201, Body: ioutil.NopCloser(strings.NewReader(`{"id": "21"}`))}
+	p := newPair("create user", req, resp)
+
+	//the given request and response can still be read
+	b, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"name": "bob"}`, string(b))
+
+	mock := httptest.NewServer(p.GenerateHandler())
+	defer mock.Close()
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != `{"name": "bob"}` || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(400)
+			return
+		}
+
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"id": "21"}`)
+	}))
+	defer svr.Close()
+
+	//handler and test should work any number of times, in parallel
+	test := p.GenerateTest()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(mock.URL, "application/json", nil)
+			if assert.NoError(t, err) {
+				b, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				assert.Equal(t, `{"id": "21"}`, string(b))
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, test(context.Background(), svr.URL, "localhost", http.DefaultClient, empty_test_conf))
+		}()
+	}
+
+	wg.Wait()
+
+	//the example itself is left untouched
+	assert.Equal(t, "", p.Request.URL.Host)
+}
+
+func TestTestsDeadline(t *testing.T) {
+	p, err := NewPairFromData(&CaseData{
+		Name:    "slow user",
+		When:    When{Method: "GET", Path: "/users/21"},
+		Then:    Then{StatusCode: 200},
+		Timeout: "20ms",
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 20*time.Millisecond, p.Timeout)
+
+	//service that hangs until the client gives up
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer hanging.Close()
+
+	//case timeout
+	start := time.Now()
+	err = p.GenerateTest()(context.Background(), hanging.URL, "localhost", http.DefaultClient, empty_test_conf)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	//suite cancellation
+	p.Timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start = time.Now()
+	err = p.GenerateTest()(ctx, hanging.URL, "localhost", http.DefaultClient, empty_test_conf)
+	assert.Error(t, err)
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.True(t, time.Since(start) < time.Second)
+
+	//invalid durations are reported
+	_, err = NewPairFromData(&CaseData{Name: "A", When: When{Method: "GET", Path: "/"}, Timeout: "soon"}, &ManifestData{})
+	assert.Error(t, err)
+}
+
+func TestManifestDefaults(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name:     "users",
+		BasePath: "/api/",
+		Headers:  http.Header{"Accept": []string{"application/json"}, "X-Client": []string{"docs"}},
+		Resources: []*ResourceData{
+			{Pattern: "/users/:user_id", Cases: []*CaseData{
+				{Name: "a user", When: When{Method: "GET", Path: "/users/21?full=1", Headers: http.Header{"Accept": []string{"text/plain"}}}, Then: Then{StatusCode: 200}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := m.Resources()
+	assert.Equal(t, "/api/users/:user_id", res[0].Pattern())
+
+	as, _ := res[0].Actions()
+	p := as[0].Pairs()[0]
+	assert.Equal(t, "/api/users/21", p.Request.URL.Path)
+	assert.Equal(t, "full=1", p.Request.URL.RawQuery)
+
+	//headers of the case take precedence
+	assert.Equal(t, "text/plain", p.Request.Header.Get("Accept"))
+	assert.Equal(t, "docs", p.Request.Header.Get("X-Client"))
 }
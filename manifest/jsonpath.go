@@ -0,0 +1,317 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A path into a decoded JSON document, e.g: $.users[0].id. The
+// wildcard [*] selects every element of an array
+type JSONPath struct {
+	raw   string
+	steps []pathStep
+}
+
+type pathStep struct {
+	key   string
+	index int //-1 for every element
+	isKey bool
+}
+
+func ParseJSONPath(s string) (*JSONPath, error) {
+	p := &JSONPath{raw: s}
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("Invalid JSON path '%s', expected it to start with '$'", s)
+	}
+
+	rest := s[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("Invalid JSON path '%s', empty key", s)
+			}
+
+			p.steps = append(p.steps, pathStep{key: key, isKey: true})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Invalid JSON path '%s', missing ']'", s)
+			}
+
+			idx := rest[1:end]
+			if idx == "*" {
+				p.steps = append(p.steps, pathStep{index: -1})
+			} else {
+				i, err := strconv.Atoi(idx)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("Invalid JSON path '%s', index '%s' is not '*' or a positive number", s, idx)
+				}
+
+				p.steps = append(p.steps, pathStep{index: i})
+			}
+
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("Invalid JSON path '%s', unexpected '%c'", s, rest[0])
+		}
+	}
+
+	return p, nil
+}
+
+func (p *JSONPath) String() string {
+	return p.raw
+}
+
+// Returns every value the path selects
+func (p *JSONPath) Find(v interface{}) []interface{} {
+	vals := []interface{}{v}
+	for _, st := range p.steps {
+		next := []interface{}{}
+		for _, val := range vals {
+			switch t := val.(type) {
+			case map[string]interface{}:
+				if el, ok := t[st.key]; ok && st.isKey {
+					next = append(next, el)
+				}
+			case []interface{}:
+				if st.isKey {
+					continue
+				}
+
+				if st.index == -1 {
+					next = append(next, t...)
+				} else if st.index < len(t) {
+					next = append(next, t[st.index])
+				}
+			}
+		}
+
+		vals = next
+	}
+
+	return vals
+}
+
+// Removes what the path selects: object fields are deleted, array
+// elements are set to null so other indexes stay the same. Returns
+// wether anything was selected
+func (p *JSONPath) Remove(v interface{}) bool {
+	if len(p.steps) == 0 {
+		return false
+	}
+
+	removed := false
+
+	parent := &JSONPath{steps: p.steps[:len(p.steps)-1]}
+	last := p.steps[len(p.steps)-1]
+	for _, val := range parent.Find(v) {
+		switch t := val.(type) {
+		case map[string]interface{}:
+			if _, ok := t[last.key]; ok && last.isKey {
+				delete(t, last.key)
+				removed = true
+			}
+		case []interface{}:
+			for i := range t {
+				if !last.isKey && (last.index == -1 || last.index == i) {
+					t[i] = nil
+					removed = true
+				}
+			}
+		}
+	}
+
+	return removed
+}
+
+// An expectation about the values at a JSON path, written as the path
+// followed by a check, e.g:
+//
+//	$.id @present
+//	$.items length 3
+//	$.name == "bob"
+//	$.links[*].href @prefix: /users/
+type Expectation struct {
+	raw  string
+	Path *JSONPath
+
+	equals  interface{}
+	length  int
+	matcher *ValueMatcher
+	kind    string
+}
+
+func ParseExpectation(s string) (*Expectation, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.SplitN(s, " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid expectation '%s', expected a JSON path followed by '== <json>', 'length <n>' or a matcher", s)
+	}
+
+	path, err := ParseJSONPath(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Expectation{raw: s, Path: path}
+	check := strings.TrimSpace(parts[1])
+	switch {
+	case strings.HasPrefix(check, "=="):
+		e.kind = "=="
+		err = json.Unmarshal([]byte(strings.TrimSpace(check[2:])), &e.equals)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expectation '%s', the value is not valid JSON: %s", s, err)
+		}
+	case strings.HasPrefix(check, "length "):
+		e.kind = "length"
+		e.length, err = strconv.Atoi(strings.TrimSpace(check[len("length "):]))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expectation '%s', the length is not a number", s)
+		}
+	case strings.HasPrefix(check, "@"):
+		e.kind = "match"
+		e.matcher, err = ParseValueMatcher(check)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Invalid expectation '%s', unknown check '%s'", s, check)
+	}
+
+	return e, nil
+}
+
+func (e *Expectation) String() string {
+	return e.raw
+}
+
+// Checks the decoded document, if the expectation doesn't hold the
+// offending value is returned as JSON with a description
+func (e *Expectation) Check(doc interface{}) (string, error) {
+	vals := e.Path.Find(doc)
+	if len(vals) == 0 {
+		return "", fmt.Errorf("Expected a value at '%s'", e.Path)
+	}
+
+	for _, v := range vals {
+		actual := encodeJSON(v)
+		switch e.kind {
+		case "==":
+			if !reflect.DeepEqual(v, e.equals) {
+				return actual, fmt.Errorf("Expected '%s' to equal %s, got %s", e.Path, encodeJSON(e.equals), actual)
+			}
+		case "length":
+			l := -1
+			switch t := v.(type) {
+			case []interface{}:
+				l = len(t)
+			case map[string]interface{}:
+				l = len(t)
+			case string:
+				l = utf8.RuneCountInString(t)
+			}
+
+			if l != e.length {
+				return actual, fmt.Errorf("Expected '%s' to have length %d, got %s", e.Path, e.length, actual)
+			}
+		case "match":
+			s, ok := v.(string)
+			if !ok {
+				s = actual
+			}
+
+			if !e.matcher.Match(s) {
+				return actual, fmt.Errorf("Expected '%s' to match '%s', got %s", e.Path, e.matcher, actual)
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// decodes JSON with numbers kept as written, e.g large ids
+func decodeNumbers(b []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// removes the ignored paths from the expected and actual body, bodies
+// that aren't JSON or have none of the paths are returned as is
+func (p *Pair) withoutIgnored(exp, act []byte) ([]byte, []byte) {
+	if len(p.Ignore) == 0 {
+		return exp, act
+	}
+
+	v1, err1 := decodeNumbers(exp)
+	v2, err2 := decodeNumbers(act)
+	if err1 != nil || err2 != nil {
+		return exp, act
+	}
+
+	removed := false
+	for _, path := range p.Ignore {
+		r1, r2 := path.Remove(v1), path.Remove(v2)
+		removed = removed || r1 || r2
+	}
+
+	if !removed {
+		return exp, act
+	}
+
+	b1, err1 := json.Marshal(v1)
+	b2, err2 := json.Marshal(v2)
+	if err1 != nil || err2 != nil {
+		return exp, act
+	}
+
+	return b1, b2
+}
+
+// checks the expectations of the example against the actual body
+func (p *Pair) assertFields(act []byte) error {
+	if len(p.Expect) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(act, &doc); err != nil {
+		return AssertError{
+			Case:    p.Name,
+			Part:    PartBody,
+			Actual:  string(act),
+			Message: fmt.Sprintf("Expected a JSON body to check field expectations: %s", err),
+		}
+	}
+
+	for _, e := range p.Expect {
+		if actual, err := e.Check(doc); err != nil {
+			return AssertError{
+				Case:     p.Name,
+				Part:     PartBody,
+				Key:      e.Path.String(),
+				Expected: e.String(),
+				Actual:   actual,
+				Message:  err.Error(),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"items": [{"id": 1, "tags": ["a"]}, {"id": 2}], "total": 2}`), &doc)
+
+	for path, exp := range map[string][]interface{}{
+		"$":               {doc},
+		"$.total":         {2.0},
+		"$.items[1].id":   {2.0},
+		"$.items[*].id":   {1.0, 2.0},
+		"$.items[0].tags": {[]interface{}{"a"}},
+		"$.items[5]":      {},
+		"$.missing":       {},
+	} {
+		p, err := ParseJSONPath(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, exp, p.Find(doc), path)
+		}
+	}
+
+	for _, path := range []string{"", "items", "$.", "$.items[", "$.items[-1]", "$items"} {
+		_, err := ParseJSONPath(path)
+		assert.Error(t, err, path)
+	}
+
+	p, _ := ParseJSONPath("$.items[*].id")
+	p.Remove(doc)
+	b, _ := json.Marshal(doc)
+	assert.Equal(t, `{"items":[{"tags":["a"]},{}],"total":2}`, string(b))
+}
+
+func TestFieldExpectations(t *testing.T) {
+	p, err := NewPairFromData(&CaseData{
+		Name: "list of notes",
+		When: When{Method: "GET", Path: "/notes"},
+		Then: Then{
+			StatusCode: 200,
+			Headers:    http.Header{"Content-Type": []string{"application/json"}},
+			Body:       `{"items": [{"id": "1", "created_at": "2015-01-01"}], "total": 1}`,
+			Expect:     []string{"$.items length 1", `$.total == 1`, "$.items[*].id @regex: ^[0-9]+$"},
+			Ignore:     []string{"$.items[*].created_at"},
+		},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := func(body string) *http.Response {
+		return &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+
+	//ignored fields may differ
+	assert.NoError(t, p.IsExpectedResponse(resp(`{"items": [{"id": "1", "created_at": "2016-02-02"}], "total": 1}`)))
+
+	//expectations are checked in addition to the example
+	p.Expect = append(p.Expect, mustExpectation(t, `$.items[0].id == "2"`))
+	err = p.IsExpectedResponse(resp(`{"items": [{"id": "1", "created_at": "2016-02-02"}], "total": 1}`))
+	if aerr, ok := err.(AssertError); assert.True(t, ok) {
+		assert.Equal(t, PartBody, aerr.Part)
+		assert.Equal(t, "$.items[0].id", aerr.Key)
+		assert.Equal(t, `"1"`, aerr.Actual)
+	}
+
+	//invalid expectations are reported
+	for _, exp := range []string{"$.items", "$.items length many", "$.items == {", "$.items contains 1", "items @present"} {
+		_, err := ParseExpectation(exp)
+		assert.Error(t, err, exp)
+	}
+
+	//the length of a string is counted in characters
+	var doc interface{}
+	err = json.Unmarshal([]byte(`{"name": "héllo"}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mustExpectation(t, "$.name length 5").Check(doc)
+	assert.NoError(t, err)
+	_, err = mustExpectation(t, "$.name length 6").Check(doc)
+	assert.Error(t, err)
+}
+
+func TestIgnoredFieldsKeepNumbers(t *testing.T) {
+	p, err := NewPairFromData(&CaseData{
+		Name: "a single note",
+		When: When{Method: "GET", Path: "/notes/1"},
+		Then: Then{
+			StatusCode: 200,
+			Headers:    http.Header{"Content-Type": []string{"application/json"}},
+			Body:       `{"id": 9007199254740993, "created_at": "2015-01-01"}`,
+			Ignore:     []string{"$.created_at"},
+		},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := func(body string) *http.Response {
+		return &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+
+	//large integers are not rounded
+	assert.NoError(t, p.IsExpectedResponse(resp(`{"id": 9007199254740993, "created_at": "2016-02-02"}`)))
+	assert.Error(t, p.IsExpectedResponse(resp(`{"id": 9007199254740992, "created_at": "2016-02-02"}`)))
+
+	//bodies without ignored fields are compared as they were sent
+	path, err := ParseJSONPath("$.updated_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Ignore = []*JSONPath{path}
+	err = p.IsExpectedResponse(resp(`{"id":  9007199254740993, "created_at": "2015-01-01"}`))
+	if aerr, ok := err.(AssertError); assert.True(t, ok) {
+		assert.Equal(t, `{"id":  9007199254740993, "created_at": "2015-01-01"}`, aerr.Actual)
+	}
+}
+
+func mustExpectation(t *testing.T, s string) *Expectation {
+	e, err := ParseExpectation(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
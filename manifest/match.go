@@ -0,0 +1,202 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Request headers that, when specified by an example, need to be send
+// with the same value for the example to match a request. This allows
+// e.g an 'unauthorized' case to be selected for requests without a token
+var MatchHeaders = []string{"Authorization", "Cookie"}
+
+// A candidate is an example that was considered for responding to a request
+type Candidate struct {
+	Pair       *Pair
+	Score      int
+	Mismatches []string
+}
+
+// Matches a sinatra style pattern (e.g /users/:user_id or note-:note_id-:author_id)
+// against a path and returns the path parameters. A parameter captures until the
+// character following it in the pattern, it never spans multiple path segments
+func MatchPattern(pattern, p string) (map[string]string, bool) {
+	params := map[string]string{}
+
+	i, j := 0, 0
+	for i < len(pattern) {
+		if pattern[i] != ':' {
+			if j >= len(p) || p[j] != pattern[i] {
+				return nil, false
+			}
+
+			i++
+			j++
+			continue
+		}
+
+		//read parameter name
+		k := i + 1
+		for k < len(pattern) && isParamChar(pattern[k]) {
+			k++
+		}
+
+		stop := byte('/')
+		if k < len(pattern) {
+			stop = pattern[k]
+		}
+
+		//read value up to the next literal
+		l := j
+		for l < len(p) && p[l] != stop && p[l] != '/' {
+			l++
+		}
+
+		if l == j {
+			return nil, false
+		}
+
+		params[pattern[i+1:k]] = p[j:l]
+		i, j = k, l
+	}
+
+	if j != len(p) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+func isParamChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Scores how well the example matches a live request. Path parameters and the
+// body with the same value as the example increase the score, the query and
+// any MatchHeaders of the example are required: the reasons they didn't
+// match are returned and a pair with mismatches should not be used to respond
+func (p *Pair) Score(r *http.Request, body []byte, pattern string, params map[string]string) (int, []string) {
+	score := 0
+	mismatches := []string{}
+
+	//path parameters of the example
+	if expparams, ok := MatchPattern(pattern, p.Request.URL.Path); ok {
+		for name, expval := range expparams {
+			if params[name] == expval {
+				score += 2
+			}
+		}
+	}
+
+	//query parameters
+	q := r.URL.Query()
+	for key, expvals := range p.Request.URL.Query() {
+		if !reflect.DeepEqual(q[key], expvals) {
+			mismatches = append(mismatches, fmt.Sprintf("query parameter '%s' should be %v, got %v", key, expvals, q[key]))
+			continue
+		}
+
+		score++
+	}
+
+	//selected headers
+	for _, key := range MatchHeaders {
+		expval := p.Request.Header.Get(key)
+		if expval == "" {
+			continue
+		}
+
+		if r.Header.Get(key) != expval {
+			mismatches = append(mismatches, fmt.Sprintf("header '%s' should be '%s'", key, expval))
+			continue
+		}
+
+		score++
+	}
+
+	//body
+	if len(p.RequestBody) > 0 && equalBodies(p.RequestBody, body) {
+		score++
+	}
+
+	return score, mismatches
+}
+
+// bodies are equal if they are byte equal or represent the same JSON
+func equalBodies(b1, b2 []byte) bool {
+	if bytes.Equal(bytes.TrimSpace(b1), bytes.TrimSpace(b2)) {
+		return true
+	}
+
+	var v1, v2 interface{}
+	if json.Unmarshal(b1, &v1) != nil || json.Unmarshal(b2, &v2) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(v1, v2)
+}
+
+// Scores every example of the action against the request, the returned
+// candidates are in the order of the examples
+func (a *Action) Candidates(r *http.Request, params map[string]string) ([]*Candidate, error) {
+	body, err := drainBody(&r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if params == nil {
+		params, _ = MatchPattern(a.pattern, r.URL.Path)
+	}
+
+	cands := []*Candidate{}
+	for _, p := range a.pairs {
+		score, mismatches := p.Score(r, body, a.pattern, params)
+		cands = append(cands, &Candidate{p, score, mismatches})
+	}
+
+	return cands, nil
+}
+
+// Selects the example that best matches the request, on equal scores a
+// success-like example is prefered over others and earlier over later
+// examples. If none matches nil is returned
+func (a *Action) Match(r *http.Request, params map[string]string) (*Pair, []*Candidate, error) {
+	cands, err := a.Candidates(r, params)
+	if err != nil {
+		return nil, cands, err
+	}
+
+	var best *Candidate
+	for _, c := range cands {
+		if len(c.Mismatches) > 0 {
+			continue
+		}
+
+		if best == nil || c.Score > best.Score || (c.Score == best.Score && c.Pair.IsSuccessLike() && !best.Pair.IsSuccessLike()) {
+			best = c
+		}
+	}
+
+	if best == nil {
+		return nil, cands, nil
+	}
+
+	return best.Pair, cands, nil
+}
+
+// responds to a request no example matched with an explanation
+func writeNoMatch(w http.ResponseWriter, r *http.Request, cands []*Candidate) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNotImplemented)
+
+	fmt.Fprintf(w, "No example matches '%s %s', candidates:\n", r.Method, r.URL.RequestURI())
+	for _, c := range cands {
+		fmt.Fprintf(w, " - '%s' (%d %s)\n", c.Pair.Name, c.Pair.Response.StatusCode, c.Pair.Request.URL.RequestURI())
+		for _, m := range c.Mismatches {
+			fmt.Fprintf(w, "   %s\n", m)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestMatchPattern(t *testing.T) {
+	params, ok := MatchPattern("/users/:user_id", "/users/21")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"user_id": "21"}, params)
+
+	params, ok = MatchPattern("/notes/note-:note_id-:author_id", "/notes/note-12-3")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"note_id": "12", "author_id": "3"}, params)
+
+	for pattern, p := range map[string]string{
+		"/users/:user_id":    "/users/21/notes",
+		"/users":             "/users/21",
+		"/users/:user_id/":   "/users/",
+		"/notes/note-:id":    "/notes/12",
+		"/users/:user_id/me": "/users/21/you",
+	} {
+		_, ok = MatchPattern(pattern, p)
+		assert.False(t, ok, pattern)
+	}
+}
+
+func TestMatchErrorCases(t *testing.T) {
+	pair := func(name, method, path, auth string, code int, body string) *Pair {
+		req, _ := http.NewRequest(method, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		return newPair(name, req, &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader(body))})
+	}
+
+	as, err := NewResource("/users/:user_id",
+		pair("found", "GET", "/users/21", "Bearer abc", 200, `{"id": "21"}`),
+		pair("not found", "GET", "/users/404", "Bearer abc", 404, `{}`),
+		pair("unauthorized", "GET", "/users/21", "", 401, ``),
+	).Actions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := as[0].Handler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path string
+		auth string
+		code int
+	}{
+		{"/users/21", "Bearer abc", 200},
+		{"/users/99", "Bearer abc", 200},
+		{"/users/404", "Bearer abc", 404},
+		{"/users/21", "", 401},
+		{"/users/404", "Bearer other", 401},
+	} {
+		req, _ := http.NewRequest("GET", c.path, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, c.code, rec.Code, c.path+" "+c.auth)
+	}
+}
+
+func TestMatchNone(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/notes?author=1", nil)
+	p := newPair("filtered list of notes", req, &http.Response{StatusCode: 200})
+
+	as, err := NewResource("/notes", p).Actions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := as[0].Handler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//unmatched requests are explained
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/notes?author=2", nil))
+	assert.Equal(t, 501, rec.Code)
+	assert.Contains(t, rec.Body.String(), "'filtered list of notes'")
+	assert.Contains(t, rec.Body.String(), "query parameter 'author' should be [1], got [2]")
+}
@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/zenazn/goji/web"
+)
+
+// The key in the web.C environment under which an action handler
+// stores the name of the example it responded with
+const CaseEnvKey = "dockpit.case"
+
+type route struct {
+	pattern string
+	actions []A
+}
+
+// Routes requests to the actions of resources by their pattern
+type Router struct {
+	routes []*route
+}
+
+func NewRouter(res []R) (*Router, error) {
+	rt := &Router{}
+	for _, r := range res {
+		as, err := r.Actions()
+		if err != nil {
+			return nil, err
+		}
+
+		//every example has to have headers a mock can respond with
+		for _, a := range as {
+			for _, p := range a.Pairs() {
+				if err := p.mockHeaders(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		rt.routes = append(rt.routes, &route{r.Pattern(), as})
+	}
+
+	return rt, nil
+}
+
+// Returns a handler that mocks every resource of the manifest
+func (c *Manifest) Handler() (*Router, error) {
+	res, err := c.Resources()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRouter(res)
+}
+
+// find the resource for a path, if multiple patterns match the one with the
+// most literal characters (e.g /users/me over /users/:user_id) is used
+func (rt *Router) find(p string) (*route, map[string]string) {
+	var best *route
+	var bestparams map[string]string
+	bestlit := -1
+	for _, r := range rt.routes {
+		params, ok := MatchPattern(r.pattern, p)
+		if !ok {
+			continue
+		}
+
+		lit := len(p)
+		for _, v := range params {
+			lit -= len(v)
+		}
+
+		if lit > bestlit {
+			best, bestparams, bestlit = r, params, lit
+		}
+	}
+
+	return best, bestparams
+}
+
+// find the action for a method, HEAD requests are served
+// by GET examples if there are no HEAD examples
+func (r *route) action(method string) A {
+	var get A
+	for _, a := range r.actions {
+		if a.Method() == method {
+			return a
+		}
+
+		if a.Method() == "GET" {
+			get = a
+		}
+	}
+
+	if method == "HEAD" {
+		return get
+	}
+
+	return nil
+}
+
+// value for the Allow header
+func (r *route) allow() string {
+	methods := []string{}
+	head := false
+	for _, a := range r.actions {
+		methods = append(methods, a.Method())
+		head = head || a.Method() == "HEAD"
+	}
+
+	//implicitely served by GET
+	if !head && r.action("HEAD") != nil {
+		methods = append(methods, "HEAD")
+	}
+
+	return strings.Join(methods, ", ")
+}
+
+func (rt *Router) ServeHTTPC(c web.C, w http.ResponseWriter, r *http.Request) {
+	rt.serve(c, w, r)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.serve(web.C{}, w, r)
+}
+
+// serves the request and returns the context the action handler was called
+// with, the name of the example that responded is stored under CaseEnvKey
+func (rt *Router) serve(c web.C, w http.ResponseWriter, r *http.Request) web.C {
+	if c.Env == nil {
+		c.Env = map[interface{}]interface{}{}
+	}
+
+	ro, params := rt.find(r.URL.Path)
+	if ro == nil {
+		http.Error(w, fmt.Sprintf("No resource pattern matches '%s'", r.URL.Path), http.StatusNotFound)
+		return c
+	}
+
+	a := ro.action(r.Method)
+	if a == nil {
+		w.Header().Set("Allow", ro.allow())
+		http.Error(w, fmt.Sprintf("Resource '%s' has no examples for method %s", ro.pattern, r.Method), http.StatusMethodNotAllowed)
+		return c
+	}
+
+	h, err := a.Handler(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return c
+	}
+
+	c.URLParams = params
+	h.ServeHTTPC(c, w, r)
+	return c
+}
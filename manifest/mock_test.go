@@ -0,0 +1,85 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestManifestHandler(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name: "notes",
+		Resources: []*ResourceData{
+			{Pattern: "/notes", Cases: []*CaseData{
+				{Name: "list of notes", When: When{Method: "GET", Path: "/notes"}, Then: Then{StatusCode: 200, Body: `[]`}},
+				{Name: "create a note", When: When{Method: "POST", Path: "/notes"}, Then: Then{StatusCode: 201, Body: `{"id": "1"}`}},
+			}},
+			{Pattern: "/notes/note-:note_id-:author_id", Cases: []*CaseData{
+				{Name: "a note", When: When{Method: "GET", Path: "/notes/note-1-2"}, Then: Then{StatusCode: 200, Body: `{"id": "1"}`}},
+				{Name: "unknown note", When: When{Method: "GET", Path: "/notes/note-404-2"}, Then: Then{StatusCode: 404, Body: `{}`}},
+			}},
+			{Pattern: "/notes/note-latest", Cases: []*CaseData{
+				{Name: "latest note", When: When{Method: "GET", Path: "/notes/note-latest"}, Then: Then{StatusCode: 200, Body: `{"id": "9"}`}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := m.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr := httptest.NewServer(h)
+	defer svr.Close()
+
+	for _, c := range []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/notes", 200, `[]`},
+		{"POST", "/notes", 201, `{"id": "1"}`},
+		{"GET", "/notes/note-1-2", 200, `{"id": "1"}`},
+		{"GET", "/notes/note-7-2", 200, `{"id": "1"}`},
+		{"GET", "/notes/note-404-2", 404, `{}`},
+		{"GET", "/notes/note-latest", 200, `{"id": "9"}`},
+		{"HEAD", "/notes", 200, ``},
+	} {
+		req, _ := http.NewRequest(c.method, svr.URL+c.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, c.code, resp.StatusCode, c.method+" "+c.path)
+		assert.Equal(t, c.body, string(body), c.method+" "+c.path)
+	}
+
+	//unknown resources
+	resp, err := http.Get(svr.URL + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 404, resp.StatusCode)
+
+	//undefined methods
+	req, _ := http.NewRequest("DELETE", svr.URL+"/notes", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 405, resp.StatusCode)
+	assert.Equal(t, "GET, POST, HEAD", resp.Header.Get("Allow"))
+}
@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/zenazn/goji/web"
+)
+
+// A Recorder mocks a manifest like its Router but also records which example
+// responded to each request. It serves the recordings at '/_recordings?case=<name>'
+// in the format the tests of dependent services expect ({"Count": n}), a
+// POST or DELETE to '/_reset' clears them.
+type Recorder struct {
+	router *Router
+	cases  map[string]bool
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewRecorder(m M) (*Recorder, error) {
+	res, err := m.Resources()
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := NewRouter(res)
+	if err != nil {
+		return nil, err
+	}
+
+	//recordings are only available for known cases
+	cases := map[string]bool{}
+	for _, ro := range rt.routes {
+		for _, a := range ro.actions {
+			for _, p := range a.Pairs() {
+				cases[p.Name] = true
+			}
+		}
+	}
+
+	return &Recorder{
+		router: rt,
+		cases:  cases,
+		counts: map[string]int{},
+	}, nil
+}
+
+// Returns how often the example with the given name responded
+func (rec *Recorder) Count(cname string) int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.counts[cname]
+}
+
+// Forgets all recordings
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.counts = map[string]int{}
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/_recordings":
+		cname := r.URL.Query().Get("case")
+		if !rec.cases[cname] {
+			http.Error(w, fmt.Sprintf("No case named '%s'", cname), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct{ Count int }{rec.Count(cname)})
+	case "/_reset":
+		if r.Method != "POST" && r.Method != "DELETE" {
+			w.Header().Set("Allow", "POST, DELETE")
+			http.Error(w, "Reset recordings with POST or DELETE", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rec.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		c := rec.router.serve(web.C{}, w, r)
+		if cname, ok := c.Env[CaseEnvKey].(string); ok {
+			rec.mu.Lock()
+			rec.counts[cname]++
+			rec.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestRecorder(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name: "pit-token",
+		Resources: []*ResourceData{
+			{Pattern: "/tokens/:token", Cases: []*CaseData{
+				{Name: "authorized", When: When{Method: "GET", Path: "/tokens/abc"}, Then: Then{StatusCode: 200, Body: `{}`}},
+				{Name: "unauthorized", When: When{Method: "GET", Path: "/tokens/xyz"}, Then: Then{StatusCode: 401, Body: `{}`}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := NewRecorder(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr := httptest.NewServer(rec)
+	defer svr.Close()
+
+	count := func(cname string) (int, int) {
+		resp, err := http.Get(svr.URL + "/_recordings?case=" + cname)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := &struct{ Count int }{}
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode, v.Count
+	}
+
+	for _, p := range []string{"/tokens/abc", "/tokens/abc", "/tokens/xyz"} {
+		_, err = http.Get(svr.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, n := count("authorized")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, rec.Count("unauthorized"))
+
+	//unknown cases are not found
+	code, _ = count("expired")
+	assert.Equal(t, 404, code)
+
+	//resetting clears all recordings
+	resp, err := http.Post(svr.URL+"/_reset", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 204, resp.StatusCode)
+
+	code, n = count("authorized")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 0, n)
+}
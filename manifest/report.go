@@ -0,0 +1,204 @@
+package manifest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// the name of a case as shown in reports, e.g: GET /users/:user_id 'a user'
+func (res *Result) Title() string {
+	return fmt.Sprintf("%s %s '%s'", res.Method, res.Resource, res.Case)
+}
+
+func (res *Result) message() string {
+	if res.Err == nil {
+		return ""
+	}
+
+	return res.Err.Error()
+}
+
+type jsonResult struct {
+	Resource string  `json:"resource"`
+	Method   string  `json:"method"`
+	Case     string  `json:"case"`
+	Status   Status  `json:"status"`
+	Duration float64 `json:"duration"`
+	Message  string  `json:"message,omitempty"`
+
+	//for failures
+	Part     Part   `json:"part,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+}
+
+type jsonReport struct {
+	Name     string         `json:"name"`
+	Passed   bool           `json:"passed"`
+	Duration float64        `json:"duration"`
+	Counts   map[Status]int `json:"counts"`
+	Results  []*jsonResult  `json:"results"`
+	Errors   []string       `json:"errors,omitempty"`
+}
+
+// Writes the report as JSON, durations are in seconds
+func (rep *Report) WriteJSON(w io.Writer) error {
+	out := &jsonReport{
+		Name:     rep.Name,
+		Passed:   rep.Passed(),
+		Duration: rep.Duration.Seconds(),
+		Counts:   map[Status]int{},
+		Results:  []*jsonResult{},
+	}
+
+	for _, st := range []Status{StatusPass, StatusFail, StatusError, StatusSkip} {
+		out.Counts[st] = rep.Count(st)
+	}
+
+	for _, res := range rep.Results {
+		jres := &jsonResult{
+			Resource: res.Resource,
+			Method:   res.Method,
+			Case:     res.Case,
+			Status:   res.Status,
+			Duration: res.Duration.Seconds(),
+			Message:  res.message(),
+		}
+
+		if aerr, ok := res.Err.(AssertError); ok {
+			jres.Message = aerr.Message
+			jres.Part, jres.Key, jres.Expected, jres.Actual, jres.Diff = aerr.Part, aerr.Key, aerr.Expected, aerr.Actual, aerr.Diff
+		}
+
+		out.Results = append(out.Results, jres)
+	}
+
+	for _, err := range rep.Errors {
+		out.Errors = append(out.Errors, err.Error())
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitSuite struct {
+	XMLName   xml.Name     `xml:"testsuite"`
+	Name      string       `xml:"name,attr"`
+	Tests     int          `xml:"tests,attr"`
+	Failures  int          `xml:"failures,attr"`
+	Errors    int          `xml:"errors,attr"`
+	Skipped   int          `xml:"skipped,attr"`
+	Time      string       `xml:"time,attr"`
+	Cases     []*junitCase `xml:"testcase"`
+	SystemErr []string     `xml:"system-err,omitempty"`
+}
+
+// Writes the report as a JUnit XML test suite, each resource and
+// method is a class with the cases as its tests
+func (rep *Report) WriteJUnit(w io.Writer) error {
+	suite := &junitSuite{
+		Name:     rep.Name,
+		Tests:    len(rep.Results),
+		Failures: rep.Count(StatusFail),
+		Errors:   rep.Count(StatusError),
+		Skipped:  rep.Count(StatusSkip),
+		Time:     fmt.Sprintf("%.3f", rep.Duration.Seconds()),
+	}
+
+	for _, res := range rep.Results {
+		c := &junitCase{
+			ClassName: res.Method + " " + res.Resource,
+			Name:      res.Case,
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+
+		msg := &junitMessage{Message: firstLine(res.message()), Body: res.message()}
+		switch res.Status {
+		case StatusFail:
+			c.Failure = msg
+		case StatusError:
+			c.Error = msg
+		case StatusSkip:
+			c.Skipped = msg
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	for _, err := range rep.Errors {
+		suite.SystemErr = append(suite.SystemErr, err.Error())
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suite)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// Writes the report in the Test Anything Protocol (version 13), errors
+// and failures are described in a YAML block below the test line, errors
+// outside of cases are written as "Bail out!" lines at the end
+func (rep *Report) WriteTAP(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(rep.Results))
+	if err != nil {
+		return err
+	}
+
+	for i, res := range rep.Results {
+		switch res.Status {
+		case StatusPass:
+			_, err = fmt.Fprintf(w, "ok %d - %s\n", i+1, res.Title())
+		case StatusSkip:
+			_, err = fmt.Fprintf(w, "ok %d - %s # SKIP %s\n", i+1, res.Title(), firstLine(res.message()))
+		default:
+			_, err = fmt.Fprintf(w, "not ok %d - %s\n  ---\n  severity: %s\n  message: |\n    %s\n  ...\n", i+1, res.Title(), res.Status, strings.Replace(res.message(), "\n", "\n    ", -1))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rerr := range rep.Errors {
+		_, err = fmt.Fprintf(w, "Bail out! %s\n", firstLine(rerr.Error()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
@@ -0,0 +1,306 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dockpit/pit/config"
+)
+
+// The outcome of testing a single case
+type Status string
+
+const (
+	StatusPass  = Status("pass")
+	StatusFail  = Status("fail")
+	StatusError = Status("error")
+	StatusSkip  = Status("skip")
+)
+
+// The result of testing a single case. A failed case did not respond as the
+// example expects (an AssertError), an error means the case could not be
+// tested at all, e.g because the service or a dependency was unreachable
+type Result struct {
+	Resource string
+	Method   string
+	Case     string
+	Status   Status
+	Duration time.Duration
+
+	//why the case failed, errored or was skipped
+	Err error
+}
+
+// The results of a test run, in the order of the cases in the manifest
+type Report struct {
+	Name     string
+	Results  []*Result
+	Duration time.Duration
+
+	//errors that didn't happen in any case, e.g stopping a state
+	Errors []error
+}
+
+// Returns the number of results with the given status
+func (rep *Report) Count(st Status) int {
+	n := 0
+	for _, res := range rep.Results {
+		if res.Status == st {
+			n++
+		}
+	}
+
+	return n
+}
+
+// A report passes if no case failed or errored
+func (rep *Report) Passed() bool {
+	return rep.Count(StatusFail) == 0 && rep.Count(StatusError) == 0 && len(rep.Errors) == 0
+}
+
+// Tests every case of a manifest against a service
+type Runner struct {
+	manifest M
+	conf     config.C
+
+	//the client used to call the service and dependency mocks
+	Client *http.Client
+
+	//the number of cases tested at the same time, defaults to one
+	Parallel int
+
+	//a deadline for the whole run, zero means no limit
+	Timeout time.Duration
+
+	//if set only cases it returns true for are tested, others are skipped
+	Filter func(p *Pair) bool
+
+	//if set the states cases are given are build and started before
+	//the cases are tested and stopped afterwards, build output is
+	//written to Out
+	States StateManager
+	Out    io.Writer
+}
+
+func NewRunner(m M, conf config.C) *Runner {
+	return &Runner{
+		manifest: m,
+		conf:     conf,
+		Client:   http.DefaultClient,
+		Parallel: 1,
+		Out:      ioutil.Discard,
+	}
+}
+
+type job struct {
+	res  *Result
+	pair *Pair
+}
+
+// cases that are given the same states
+type group struct {
+	states [][2]string
+	jobs   []*job
+}
+
+// groups jobs by their given states, groups are in the
+// order in which the manifest first mentions their states
+func groupJobs(jobs []*job) []*group {
+	groups := []*group{}
+	bykey := map[string]*group{}
+	for _, j := range jobs {
+		states := [][2]string{}
+		for pname, g := range j.pair.Given {
+			for _, sname := range g.States() {
+				states = append(states, [2]string{pname, sname})
+			}
+		}
+
+		//states of a provider keep the order they are given in
+		sort.SliceStable(states, func(i, k int) bool { return states[i][0] < states[k][0] })
+
+		key := fmt.Sprintf("%q", states)
+		g, ok := bykey[key]
+		if !ok {
+			g = &group{states: states}
+			bykey[key] = g
+			groups = append(groups, g)
+		}
+
+		g.jobs = append(g.jobs, j)
+	}
+
+	return groups
+}
+
+// collects a job for every case in the order of the manifest
+func (run *Runner) jobs() ([]*job, error) {
+	res, err := run.manifest.Resources()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*job{}
+	for _, r := range res {
+		as, err := r.Actions()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range as {
+			for _, p := range a.Pairs() {
+				jobs = append(jobs, &job{&Result{
+					Resource: r.Pattern(),
+					Method:   a.Method(),
+					Case:     p.Name,
+				}, p})
+			}
+		}
+	}
+
+	return jobs, nil
+}
+
+// Tests all cases against the service at host, dependency mocks are asked
+// for recordings at dhost. Cases that haven't started when the context is
+// cancelled or the run times out are skipped. The returned error is only
+// non-nil if the manifest itself couldn't be walked.
+//
+// With a StateManager cases are tested in groups that are given the same
+// states, one group at a time: its states are started once before and
+// stopped after its cases are tested
+func (run *Runner) Run(ctx context.Context, host, dhost string) (*Report, error) {
+	jobs, err := run.jobs()
+	if err != nil {
+		return nil, err
+	}
+
+	if run.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	rep := &Report{Name: run.manifest.Name()}
+	selected := []*job{}
+	for _, j := range jobs {
+		if run.Filter != nil && !run.Filter(j.pair) {
+			j.res.Status = StatusSkip
+			continue
+		}
+
+		selected = append(selected, j)
+	}
+
+	if run.States == nil {
+		run.testAll(ctx, selected, host, dhost)
+	} else {
+		for _, g := range groupJobs(selected) {
+			rep.Errors = append(rep.Errors, run.testGroup(ctx, g, host, dhost)...)
+		}
+	}
+
+	rep.Duration = time.Since(start)
+	for _, j := range jobs {
+		rep.Results = append(rep.Results, j.res)
+	}
+
+	return rep, nil
+}
+
+// starts the states of a group, tests its cases and stops the states
+// again. Cases error if a state couldn't be started, errors while
+// stopping states are returned
+func (run *Runner) testGroup(ctx context.Context, g *group, host, dhost string) []error {
+	if err := ctx.Err(); err != nil {
+		for _, j := range g.jobs {
+			j.res.Status, j.res.Err = StatusSkip, err
+		}
+
+		return nil
+	}
+
+	started := [][2]string{}
+	var serr error
+	for _, st := range g.states {
+		_, serr = run.States.Build(st[0], st[1], run.Out)
+		if serr == nil {
+			_, serr = run.States.Start(st[0], st[1])
+		}
+
+		if serr != nil {
+			serr = fmt.Errorf("Failed to start state '%s' of provider '%s': %s", st[1], st[0], serr)
+			break
+		}
+
+		started = append(started, st)
+	}
+
+	if serr != nil {
+		for _, j := range g.jobs {
+			j.res.Status, j.res.Err = StatusError, serr
+		}
+	} else {
+		run.testAll(ctx, g.jobs, host, dhost)
+	}
+
+	//stop in reverse order
+	errs := []error{}
+	for i := len(started) - 1; i >= 0; i-- {
+		st := started[i]
+		if err := run.States.Stop(st[0], st[1]); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to stop state '%s' of provider '%s': %s", st[1], st[0], err))
+		}
+	}
+
+	return errs
+}
+
+// tests cases with bounded parallelism
+func (run *Runner) testAll(ctx context.Context, jobs []*job, host, dhost string) {
+	parallel := run.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for _, j := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(j *job) {
+			defer func() { <-sem; wg.Done() }()
+			run.test(ctx, j, host, dhost)
+		}(j)
+	}
+
+	wg.Wait()
+}
+
+// tests a single case and records the result
+func (run *Runner) test(ctx context.Context, j *job, host, dhost string) {
+	if err := ctx.Err(); err != nil {
+		j.res.Status, j.res.Err = StatusSkip, err
+		return
+	}
+
+	start := time.Now()
+	err := j.pair.GenerateTest()(ctx, host, dhost, run.Client, run.conf)
+	j.res.Duration = time.Since(start)
+
+	switch err.(type) {
+	case nil:
+		j.res.Status = StatusPass
+	case AssertError:
+		j.res.Status, j.res.Err = StatusFail, err
+	default:
+		j.res.Status, j.res.Err = StatusError, err
+	}
+}
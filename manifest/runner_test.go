@@ -0,0 +1,272 @@
+package manifest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestRunner(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name: "users",
+		Resources: []*ResourceData{
+			{Pattern: "/users/:user_id", Cases: []*CaseData{
+				{Name: "a user", When: When{Method: "GET", Path: "/users/21"}, Then: Then{StatusCode: 200, Body: `{"id": "21"}`}},
+				{Name: "no user", When: When{Method: "GET", Path: "/users/404"}, Then: Then{StatusCode: 404}},
+				{Name: "slow user", When: When{Method: "GET", Path: "/users/slow"}, Then: Then{StatusCode: 200}, Timeout: "20ms"},
+				{Name: "removed user", When: When{Method: "DELETE", Path: "/users/21"}, Then: Then{StatusCode: 204}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//service that always finds users
+	mu := sync.Mutex{}
+	running, maxrunning := 0, 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxrunning {
+			maxrunning = running
+		}
+		mu.Unlock()
+
+		defer func() { mu.Lock(); running--; mu.Unlock() }()
+
+		if r.URL.Path == "/users/slow" {
+			<-r.Context().Done()
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"id": "21"}`)
+	}))
+	defer svr.Close()
+
+	run := NewRunner(m, empty_test_conf)
+	run.Parallel = 2
+	run.Filter = func(p *Pair) bool { return p.Request.Method == "GET" }
+
+	rep, err := run.Run(context.Background(), svr.URL, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users", rep.Name)
+	assert.False(t, rep.Passed())
+	assert.True(t, maxrunning <= 2)
+
+	//results are in manifest order
+	if assert.Equal(t, 4, len(rep.Results)) {
+		assert.Equal(t, "a user", rep.Results[0].Case)
+		assert.Equal(t, StatusPass, rep.Results[0].Status)
+		assert.Equal(t, StatusFail, rep.Results[1].Status)
+		assert.IsType(t, AssertError{}, rep.Results[1].Err)
+		assert.Equal(t, StatusError, rep.Results[2].Status)
+		assert.Equal(t, StatusSkip, rep.Results[3].Status)
+		assert.Equal(t, "DELETE", rep.Results[3].Method)
+	}
+
+	//json
+	buf := bytes.NewBuffer(nil)
+	if assert.NoError(t, rep.WriteJSON(buf)) {
+		out := struct {
+			Passed  bool
+			Counts  map[string]int
+			Results []struct{ Case, Status, Message string }
+		}{}
+
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		assert.False(t, out.Passed)
+		assert.Equal(t, map[string]int{"pass": 1, "fail": 1, "error": 1, "skip": 1}, out.Counts)
+		assert.Equal(t, "no user", out.Results[1].Case)
+		assert.Equal(t, "fail", out.Results[1].Status)
+		assert.NotEqual(t, "", out.Results[1].Message)
+	}
+
+	//junit
+	buf.Reset()
+	if assert.NoError(t, rep.WriteJUnit(buf)) {
+		out := struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Errors   int `xml:"errors,attr"`
+			Skipped  int `xml:"skipped,attr"`
+			Cases    []struct {
+				ClassName string    `xml:"classname,attr"`
+				Failure   *struct{} `xml:"failure"`
+			} `xml:"testcase"`
+		}{}
+
+		assert.NoError(t, xml.Unmarshal(buf.Bytes(), &out))
+		assert.Equal(t, []int{4, 1, 1, 1}, []int{out.Tests, out.Failures, out.Errors, out.Skipped})
+		assert.Equal(t, "GET /users/:user_id", out.Cases[0].ClassName)
+		assert.NotNil(t, out.Cases[1].Failure)
+	}
+
+	//tap
+	buf.Reset()
+	if assert.NoError(t, rep.WriteTAP(buf)) {
+		lines := strings.Split(buf.String(), "\n")
+		assert.Equal(t, "TAP version 13", lines[0])
+		assert.Equal(t, "1..4", lines[1])
+		assert.Equal(t, "ok 1 - GET /users/:user_id 'a user'", lines[2])
+		assert.Equal(t, "not ok 2 - GET /users/:user_id 'no user'", lines[3])
+		assert.Contains(t, buf.String(), "ok 4 - DELETE /users/:user_id 'removed user' # SKIP")
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name: "users",
+		Resources: []*ResourceData{
+			{Pattern: "/users/:user_id", Cases: []*CaseData{
+				{Name: "a user", When: When{Method: "GET", Path: "/users/21"}, Then: Then{StatusCode: 200}},
+				{Name: "other user", When: When{Method: "GET", Path: "/users/11"}, Then: Then{StatusCode: 200}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer svr.Close()
+
+	//the suite deadline aborts the running case and skips the next
+	run := NewRunner(m, empty_test_conf)
+	run.Timeout = 20 * time.Millisecond
+
+	rep, err := run.Run(context.Background(), svr.URL, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, StatusError, rep.Results[0].Status)
+	assert.Equal(t, StatusSkip, rep.Results[1].Status)
+	assert.Equal(t, context.DeadlineExceeded, rep.Results[1].Err)
+}
+
+func TestRunnerStates(t *testing.T) {
+	given := func(states ...string) map[string]Given {
+		m := map[string]Given{}
+		for i := 0; i < len(states); i += 2 {
+			m[states[i]] = Given{Name: states[i+1]}
+		}
+
+		return m
+	}
+
+	m, err := NewManifest(&ManifestData{
+		Name: "users",
+		Resources: []*ResourceData{
+			{Pattern: "/users", Cases: []*CaseData{
+				{Name: "list of users", Given: given("mysql", "users"), When: When{Method: "GET", Path: "/users"}, Then: Then{StatusCode: 200}},
+				{Name: "no users", Given: given("mysql", "empty", "redis", "cache"), When: When{Method: "GET", Path: "/users?empty"}, Then: Then{StatusCode: 200}},
+				{Name: "broken users", Given: given("mysql", "broken"), When: When{Method: "GET", Path: "/users?broken"}, Then: Then{StatusCode: 200}},
+				{Name: "new user", Given: given("mysql", "users"), When: When{Method: "POST", Path: "/users"}, Then: Then{StatusCode: 200}},
+				{Name: "health", When: When{Method: "HEAD", Path: "/users"}, Then: Then{StatusCode: 200}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fm := NewFakeStateManager()
+	fm.Fail("mysql", "broken", errors.New("no such image"))
+
+	//service responds with 500 if the state the case is given isn't running
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sname := "users"
+		if r.URL.RawQuery != "" {
+			sname = r.URL.RawQuery
+		}
+
+		if r.Method != "HEAD" && !fm.Running("mysql", sname) {
+			w.WriteHeader(500)
+		}
+	}))
+	defer svr.Close()
+
+	run := NewRunner(m, empty_test_conf)
+	run.States = fm
+	run.Parallel = 2
+
+	rep, err := run.Run(context.Background(), svr.URL, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+	assert.Equal(t, StatusPass, rep.Results[1].Status)
+	assert.Equal(t, StatusError, rep.Results[2].Status)
+	assert.Contains(t, rep.Results[2].Err.Error(), "no such image")
+	assert.Equal(t, StatusPass, rep.Results[3].Status)
+	assert.Equal(t, StatusPass, rep.Results[4].Status)
+	assert.Equal(t, 0, len(rep.Errors))
+
+	//states are started once per group and stopped in reverse
+	assert.Equal(t, []string{
+		"build mysql/users", "start mysql/users", "stop mysql/users",
+		"build mysql/empty", "start mysql/empty", "build redis/cache", "start redis/cache", "stop redis/cache", "stop mysql/empty",
+		"build mysql/broken",
+	}, fm.Calls())
+
+	assert.False(t, fm.Running("mysql", "users"))
+}
+
+func TestRunnerMultipleStates(t *testing.T) {
+	m, err := NewManifest(&ManifestData{
+		Name: "users",
+		Resources: []*ResourceData{
+			{Pattern: "/users", Cases: []*CaseData{
+				{Name: "users and notes", Given: map[string]Given{"mysql": {Name: "users", Others: []string{"notes"}}}, When: When{Method: "GET", Path: "/users"}, Then: Then{StatusCode: 200}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := m.States()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string][]string{"mysql": {"users", "notes"}}, states)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	fm := NewFakeStateManager()
+	run := NewRunner(m, empty_test_conf)
+	run.States = fm
+
+	rep, err := run.Run(context.Background(), svr.URL, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, rep.Passed())
+	assert.Equal(t, []string{
+		"build mysql/users", "start mysql/users", "build mysql/notes", "start mysql/notes", "stop mysql/notes", "stop mysql/users",
+	}, fm.Calls())
+}
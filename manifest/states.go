@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dockpit/state"
+)
+
+// A StateManager that keeps states in memory, for testing code that
+// drives states without a container runtime. It records every call
+// and can be told to fail for specific states
+type FakeStateManager struct {
+	mu      sync.Mutex
+	calls   []string
+	running map[string]bool
+	errs    map[string]error
+}
+
+func NewFakeStateManager() *FakeStateManager {
+	return &FakeStateManager{
+		running: map[string]bool{},
+		errs:    map[string]error{},
+	}
+}
+
+func stateKey(pname, sname string) string {
+	return pname + "/" + sname
+}
+
+// Makes building and starting the state fail with the given error
+func (fm *FakeStateManager) Fail(pname, sname string, err error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.errs[stateKey(pname, sname)] = err
+}
+
+// Returns the calls in order, e.g: "start mysql/users"
+func (fm *FakeStateManager) Calls() []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	return append([]string(nil), fm.calls...)
+}
+
+// Returns whether the state is started and not yet stopped
+func (fm *FakeStateManager) Running(pname, sname string) bool {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	return fm.running[stateKey(pname, sname)]
+}
+
+func (fm *FakeStateManager) Build(pname, sname string, out io.Writer) (string, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	key := stateKey(pname, sname)
+	fm.calls = append(fm.calls, "build "+key)
+	if err := fm.errs[key]; err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(out, "built %s\n", key)
+	return key, nil
+}
+
+func (fm *FakeStateManager) Start(pname, sname string) (*state.StateContainer, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	key := stateKey(pname, sname)
+	fm.calls = append(fm.calls, "start "+key)
+	if err := fm.errs[key]; err != nil {
+		return nil, err
+	}
+
+	if fm.running[key] {
+		return nil, fmt.Errorf("State '%s' is already running", key)
+	}
+
+	fm.running[key] = true
+	return &state.StateContainer{}, nil
+}
+
+func (fm *FakeStateManager) Stop(pname, sname string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	key := stateKey(pname, sname)
+	fm.calls = append(fm.calls, "stop "+key)
+	if !fm.running[key] {
+		return fmt.Errorf("State '%s' is not running", key)
+	}
+
+	delete(fm.running, key)
+	return nil
+}
@@ -0,0 +1,105 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A status code or a range of status codes written with wildcards,
+// e.g: 204, 2xx or 20x
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// Parses a status code, a range (2xx) or alternatives of
+// those separated by a pipe (200|204)
+func ParseStatusRanges(s string) ([]StatusRange, error) {
+	ranges := []StatusRange{}
+	for _, alt := range strings.Split(s, "|") {
+		r := StatusRange{}
+		if err := r.UnmarshalText([]byte(alt)); err != nil {
+			return nil, err
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	return ranges, nil
+}
+
+// Returns whether the code is in the range
+func (r StatusRange) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+// A concrete code in the range, e.g for mocks to respond with
+func (r StatusRange) Code() int {
+	return r.Min
+}
+
+func (r StatusRange) String() string {
+	s := strconv.Itoa(r.Min)
+	for span := r.Max - r.Min + 1; span > 1; span /= 10 {
+		s = s[:len(s)-1]
+	}
+
+	return s + strings.Repeat("x", 3-len(s))
+}
+
+func (r StatusRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *StatusRange) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	digits := strings.TrimRight(strings.ToLower(s), "x")
+	if len(s) != 3 || len(digits) == 0 {
+		return fmt.Errorf("Invalid status code '%s', expected e.g: 200, 2xx or 20x", s)
+	}
+
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || digits[0] < '1' || digits[0] > '5' {
+		return fmt.Errorf("Invalid status code '%s', expected e.g: 200, 2xx or 20x", s)
+	}
+
+	span := 1
+	for i := len(digits); i < 3; i++ {
+		n *= 10
+		span *= 10
+	}
+
+	r.Min, r.Max = n, n+span-1
+	return nil
+}
+
+// Returns whether the example expects a response with the given code: any
+// of its status ranges or, without ranges, exactly the example's code
+func (p *Pair) ExpectsStatus(code int) bool {
+	if len(p.StatusCodes) == 0 {
+		return p.Response.StatusCode == code
+	}
+
+	for _, r := range p.StatusCodes {
+		if r.Contains(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the expected codes as written in the example
+func (p *Pair) expectedStatus() string {
+	if len(p.StatusCodes) == 0 {
+		return strconv.Itoa(p.Response.StatusCode)
+	}
+
+	alts := []string{}
+	for _, r := range p.StatusCodes {
+		alts = append(alts, r.String())
+	}
+
+	return strings.Join(alts, "|")
+}
@@ -0,0 +1,54 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/dockpit/lang/manifest"
+)
+
+func TestStatusRanges(t *testing.T) {
+	ranges, err := ParseStatusRanges("200|20x|4xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []StatusRange{{200, 200}, {200, 209}, {400, 499}}, ranges)
+	assert.Equal(t, "20x", ranges[1].String())
+
+	b, _ := json.Marshal(ranges)
+	assert.Equal(t, `["200","20x","4xx"]`, string(b))
+
+	for _, s := range []string{"", "2", "2000", "x00", "2x0", "600", "200|"} {
+		_, err := ParseStatusRanges(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestStatusRangeAssertion(t *testing.T) {
+	p, err := NewPairFromData(&CaseData{
+		Name: "invalid user",
+		When: When{Method: "POST", Path: "/users"},
+		Then: Then{StatusCodes: []StatusRange{{400, 499}}},
+	}, &ManifestData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//mock responds with a concrete code
+	rec := httptest.NewRecorder()
+	p.GenerateHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+	assert.Equal(t, 400, rec.Code)
+
+	assert.NoError(t, p.IsExpectedResponse(&http.Response{StatusCode: 422}))
+
+	err = p.IsExpectedResponse(&http.Response{StatusCode: 500})
+	if aerr, ok := err.(AssertError); assert.True(t, ok) {
+		assert.Equal(t, "4xx", aerr.Expected)
+		assert.Equal(t, "500", aerr.Actual)
+	}
+}
@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,8 +22,10 @@ type StateManager interface {
 	Stop(pname, sname string) error
 }
 
-//
-type TestFunc func(host, dhost string, c *http.Client, conf config.C) error
+// Tests a case against the service at host, dependency mocks are asked for
+// their recordings at dhost. Cancelling the context aborts both, a case with
+// a timeout runs with a deadline derived from it
+type TestFunc func(ctx context.Context, host, dhost string, c *http.Client, conf config.C) error
 
 //
 //
@@ -0,0 +1,72 @@
+package parser
+
+import "errors"
+
+// Severity of a diagnostic, only errors cause a parse to fail
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+
+	return "unknown"
+}
+
+// A Diagnostic is a problem encountered during parsing
+type Diagnostic struct {
+	*ParseError
+	Severity Severity
+}
+
+// Creates a diagnostic from any error, errors that are not a ParseError
+// (e.g failing to read a file) are attributed to the given file
+func NewDiagnostic(sev Severity, fpath string, err error) *Diagnostic {
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		perr = &ParseError{
+			File:    fpath,
+			Code:    ErrIO,
+			Message: err.Error(),
+		}
+	}
+
+	return &Diagnostic{perr, sev}
+}
+
+func (d *Diagnostic) String() string {
+	return d.Severity.String() + ": " + d.Error()
+}
+
+type Diagnostics []*Diagnostic
+
+// Returns only the diagnostics of the given severity
+func (ds Diagnostics) Filter(sev Severity) Diagnostics {
+	res := Diagnostics{}
+	for _, d := range ds {
+		if d.Severity == sev {
+			res = append(res, d)
+		}
+	}
+
+	return res
+}
+
+// Returns the first error (if any)
+func (ds Diagnostics) Err() error {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return d.ParseError
+		}
+	}
+
+	return nil
+}
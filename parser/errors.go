@@ -1,27 +1,140 @@
 package parser
 
-import "fmt"
+import (
+	"fmt"
+	"path/filepath"
+)
 
-func UnexpectedHeaderLineError(fpath, giv string) error {
-	return fmt.Errorf("File '%s' has an unexpected header line: '%s', expected format 'Header-Key: Value'", fpath, giv)
+// A stable identifier for the kind of problem a parser encountered,
+// use it to tell errors apart instead of matching messages
+type ErrorCode string
+
+const (
+	ErrUnexpectedDir       ErrorCode = "unexpected-dir"
+	ErrUnexpectedFile      ErrorCode = "unexpected-file"
+	ErrFileOutsideCase     ErrorCode = "file-outside-case"
+	ErrCaseOutsideResource ErrorCode = "case-outside-resource"
+	ErrDuplicateCase       ErrorCode = "duplicate-case"
+	ErrHeaderLine          ErrorCode = "header-line"
+	ErrResponseLine        ErrorCode = "response-line"
+	ErrResponseLineCode    ErrorCode = "response-line-code"
+	ErrRequestLine         ErrorCode = "request-line"
+	ErrRequestLineMethod   ErrorCode = "request-line-method"
+	ErrRequestLinePath     ErrorCode = "request-line-path"
+	ErrRequestLineQuery    ErrorCode = "request-line-query"
+	ErrDirective           ErrorCode = "directive"
+	ErrStateLine           ErrorCode = "state-line"
+	ErrLinkLine            ErrorCode = "link-line"
+	ErrLinkLineMethod      ErrorCode = "link-line-method"
+	ErrLinkLinePath        ErrorCode = "link-line-path"
+	ErrLinkLineCaseName    ErrorCode = "link-line-case-name"
+	ErrBodyReference       ErrorCode = "body-reference"
+	ErrArchetypes          ErrorCode = "archetypes"
+	ErrFrontMatter         ErrorCode = "front-matter"
+	ErrFrontMatterConflict ErrorCode = "front-matter-conflict"
+	ErrIO                  ErrorCode = "io"
+
+	ErrGivenLine            ErrorCode = "given-line"
+	ErrStatementOutsideCase ErrorCode = "statement-outside-case"
+	ErrDuplicateStatement   ErrorCode = "duplicate-statement"
+	ErrMissingBlock         ErrorCode = "missing-block"
+	ErrBlockLang            ErrorCode = "block-lang"
+	ErrDuplicateBody        ErrorCode = "duplicate-body"
+	ErrDuplicateAnchor      ErrorCode = "duplicate-anchor"
+
+	WarnIgnoredFile ErrorCode = "ignored-file"
+	WarnEmptyGiven  ErrorCode = "empty-given"
+	WarnMissingThen ErrorCode = "missing-then"
+
+	WarnDuplicateWhile ErrorCode = "duplicate-while"
+	WarnDuplicateGiven ErrorCode = "duplicate-given"
+
+	WarnUnknownFrontMatter ErrorCode = "unknown-front-matter"
+)
+
+// A ParseError points at the exact spot in a file that could not be
+// parsed. Line and Column start at 1, zero means the position is unknown
+// (e.g an error about a directory as a whole)
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Code    ErrorCode
+	Snippet string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, e.Line)
+		if e.Column > 0 {
+			pos = fmt.Sprintf("%s:%d", pos, e.Column)
+		}
+	}
+
+	return fmt.Sprintf("%s: %s", pos, e.Message)
+}
+
+func newParseError(fpath string, line, col int, code ErrorCode, snippet, format string, args ...interface{}) error {
+	return &ParseError{
+		File:    fpath,
+		Line:    line,
+		Column:  col,
+		Code:    code,
+		Snippet: snippet,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func UnexpectedHeaderLineError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrHeaderLine, giv, "unexpected header line: '%s', expected format 'Header-Key: Value'", giv)
+}
+
+func UnexpectedResponseLineError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrResponseLine, giv, "unexpected first line in 'then': %s, expected format '<HTTP Status Code> <Status Text>'", giv)
+}
+
+func UnexpectedResponseLineCodeError(fpath string, line int, giv string, err error) error {
+	return newParseError(fpath, line, 1, ErrResponseLineCode, giv, "unexpected status code in 'then': %s, expected a number, a range (2xx) or alternatives (200|204). (%s)", giv, err)
+}
+
+func UnexpectedRequestLineError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrRequestLine, giv, "unexpected first line in 'when': %s, expected format '<HTTP method> <path>'", giv)
+}
+
+func UnexpectedRequestLineMethodError(fpath string, line int, giv string, extensions []string) error {
+	return newParseError(fpath, line, 1, ErrRequestLineMethod, giv, "unexpected HTTP Method in the first line of 'when': '%s', expected one of: %s", giv, allMethods(extensions))
+}
+
+func UnexpectedRequestLinePathError(fpath string, line, col int, giv string) error {
+	return newParseError(fpath, line, col, ErrRequestLinePath, giv, "unexpected path in the first line of 'when': '%s', expected absolute path (starting with '/')", giv)
+}
+
+func UnexpectedRequestLineQueryError(fpath string, line, col int, giv string, err error) error {
+	return newParseError(fpath, line, col, ErrRequestLineQuery, giv, "unexpected query in the first line of 'when': '%s', (%s)", giv, err)
+}
+
+func UnexpectedDirectiveError(fpath string, line int, giv string, err error) error {
+	return newParseError(fpath, line, 1, ErrDirective, giv, "unexpected directive: '%s', (%s)", giv, err)
 }
 
-func UnexpectedResponseLineError(fpath, line string) error {
-	return fmt.Errorf("Parser encountered a 'then' file '%s' with an unexpected first line: %s, expected format '<HTTP Status Code> <Status Text>'", fpath, line)
+func IgnoredFileWarning(fpath string) error {
+	return newParseError(fpath, 0, 0, WarnIgnoredFile, filepath.Base(fpath), "file is ignored, it is not a case file nor referenced as data by one")
 }
 
-func UnexpectedResponseLineCodeError(fpath, giv string, err error) error {
-	return fmt.Errorf("Parser encountered a 'then' file '%s' with an unexpected status code: %s, expected a number. (%s)", fpath, giv, err)
+func EmptyGivenWarning(fpath string) error {
+	return newParseError(fpath, 0, 0, WarnEmptyGiven, "", "'given' file doesn't describe any state")
 }
 
-func UnexpectedRequestLineError(fpath, line string) error {
-	return fmt.Errorf("Parser encountered a 'when' file '%s' with an unexpected first line: %s, expected format '<HTTP method> <path>'", fpath, line)
+func DuplicateWhileWarning(fpath string, line, col int, id, cname string) error {
+	return newParseError(fpath, line, col, WarnDuplicateWhile, cname, "'%s' is expected to respond with case '%s' more than once, the duplicate is ignored", id, cname)
 }
 
-func UnexpectedRequestLineMethodError(fpath, giv string) error {
-	return fmt.Errorf("Parser encountered a 'when' file '%s' with an unexpected HTTP Method in the first line: '%s', expected one of: %s", fpath, giv, ValidHTTPMethods)
+func DuplicateGivenWarning(fpath string, line, col int, pname, sname string) error {
+	return newParseError(fpath, line, col, WarnDuplicateGiven, sname, "'%s' is given state '%s' more than once, the duplicate is ignored", pname, sname)
 }
 
-func UnexpectedRequestLinePathError(fpath, giv string) error {
-	return fmt.Errorf("Parser encountered a 'when' file '%s' with an unexpected path in the first line: '%s', expected absolute path (starting with '/')", fpath, giv)
+func MissingThenWarning(fpath, cname string) error {
+	return newParseError(fpath, 0, 0, WarnMissingThen, cname, "case '%s' has no 'then', no response is expected", cname)
 }
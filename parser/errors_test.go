@@ -0,0 +1,78 @@
+package parser_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dockpit/lang/parser"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockpit_parser_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cdir := filepath.Join(dir, "- notes", "'list of notes'")
+	err = os.MkdirAll(cdir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//third line is missing the header colon
+	err = ioutil.WriteFile(filepath.Join(cdir, "then"), []byte("200 OK\nContent-Type: text/html\nX-Broken\n\n<html></html>\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parser.NewFile(dir).Parse()
+
+	var perr *parser.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a parse error, got: %v", err)
+	}
+
+	assert.Equal(t, parser.ErrHeaderLine, perr.Code)
+	assert.Equal(t, filepath.Join(cdir, "then"), perr.File)
+	assert.Equal(t, 3, perr.Line)
+	assert.Equal(t, 1, perr.Column)
+	assert.Equal(t, "X-Broken", perr.Snippet)
+	assert.Equal(t, filepath.Join(cdir, "then")+":3:1: unexpected header line: 'X-Broken', expected format 'Header-Key: Value'", perr.Error())
+}
+
+func TestParseErrorRequestPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockpit_parser_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cdir := filepath.Join(dir, "- notes", "'list of notes'")
+	err = os.MkdirAll(cdir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(cdir, "when"), []byte("\nGET notes\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parser.NewFile(dir).Parse()
+
+	var perr *parser.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a parse error, got: %v", err)
+	}
+
+	assert.Equal(t, parser.ErrRequestLinePath, perr.Code)
+	assert.Equal(t, 2, perr.Line)
+	assert.Equal(t, 5, perr.Column)
+	assert.Equal(t, "notes", perr.Snippet)
+}
@@ -4,12 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/dockpit/assert/strategy"
@@ -19,33 +20,50 @@ import (
 var CaseEX = regexp.MustCompile(`^'(.*)'$`)
 var ResourceEX = regexp.MustCompile(`^- (.*)`)
 var VariableEX = regexp.MustCompile(`(\(.*?\))`)
+var BodyRefEX = regexp.MustCompile(`^@body:\s*(.+)$`)
 
-func UnexpectedDirError(fi os.FileInfo) error {
-	return fmt.Errorf("Parser encountered an unexpected directory: %s, expected a resource directory (starting with `- `), or a case directory formatted as `'case name'`", fi.Name())
+func UnexpectedDirError(fpath string, fi os.FileInfo) error {
+	return newParseError(fpath, 0, 0, ErrUnexpectedDir, fi.Name(), "unexpected directory: %s, expected a resource directory (starting with `- `), or a case directory formatted as `'case name'`", fi.Name())
 }
 
-func UnexpectedFileError(fi os.FileInfo) error {
-	return fmt.Errorf("Parser encountered a file without an extension: '%s', only 'given', 'when', 'then' or 'while' is allowed", fi.Name())
+func UnexpectedFileError(fpath string, fi os.FileInfo) error {
+	return newParseError(fpath, 0, 0, ErrUnexpectedFile, fi.Name(), "unexpected file without an extension: '%s', only 'given', 'when', 'then' or 'while' is allowed", fi.Name())
 }
 
-func UnexpectedStateLineError(fpath, line string) error {
-	return fmt.Errorf("Parser encountered a 'given' file '%s', with an invalid line: \n%s\n expected format \"<state provider name> '<state name>'\"", fpath, line)
+func FileOutsideCaseError(fpath string) error {
+	return newParseError(fpath, 0, 0, ErrFileOutsideCase, filepath.Base(fpath), "case file was found outside a case folder")
 }
 
-func UnexpectedLinkLineMethodError(fpath, giv string) error {
-	return fmt.Errorf("Parser encountered a 'while' file '%s' with an unexpected HTTP Method: '%s', expected one of: %s", fpath, giv, ValidHTTPMethods)
+func CaseOutsideResourceError(fpath, cname string) error {
+	return newParseError(fpath, 0, 0, ErrCaseOutsideResource, cname, "case folder '%s' is outside a resource", cname)
 }
 
-func UnexpectedLinkLinePathError(fpath, giv string) error {
-	return fmt.Errorf("Parser encountered a 'while' file '%s' with an unexpected path: '%s', expected absolute path (starting with '/')", fpath, giv)
+func DuplicateCaseError(fpath, cname, existing string) error {
+	return newParseError(fpath, 0, 0, ErrDuplicateCase, cname, "case with name '%s' already exists in '%s'", cname, existing)
 }
 
-func UnexpectedLinkLineError(fpath, line string) error {
-	return fmt.Errorf("Parser encountered a 'while' file '%s' with an unexpected line: %s, expected format \"<service id> '<case name>'\"", fpath, line)
+func UnexpectedStateLineError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrStateLine, giv, "invalid line in 'given': %s, expected format \"<state provider name>: '<state name>'\"", giv)
 }
 
-func UnexpectedLinkLineCaseNameError(fpath, line string) error {
-	return fmt.Errorf("Parser encountered a 'while' file '%s' with a invalid casename: \"%s\", expected single-quoted name: e.g 'name of the case'", fpath, line)
+func UnexpectedLinkLineMethodError(fpath string, line int, giv string, extensions []string) error {
+	return newParseError(fpath, line, 1, ErrLinkLineMethod, giv, "unexpected HTTP Method in 'while': '%s', expected one of: %s", giv, allMethods(extensions))
+}
+
+func UnexpectedLinkLinePathError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrLinkLinePath, giv, "unexpected path in 'while': '%s', expected absolute path (starting with '/')", giv)
+}
+
+func UnexpectedLinkLineError(fpath string, line int, giv string) error {
+	return newParseError(fpath, line, 1, ErrLinkLine, giv, "unexpected line in 'while': %s, expected format \"<service id> '<case name>'\"", giv)
+}
+
+func UnexpectedLinkLineCaseNameError(fpath string, line, col int, giv string) error {
+	return newParseError(fpath, line, col, ErrLinkLineCaseName, giv, "invalid casename in 'while': \"%s\", expected single-quoted name: e.g 'name of the case'", giv)
+}
+
+func UnexpectedBodyReferenceError(fpath string, line int, ref string, err error) error {
+	return newParseError(fpath, line, 1, ErrBodyReference, ref, "references a data file '%s' that could not be read: %s", ref, err)
 }
 
 type Node struct {
@@ -69,13 +87,15 @@ func (n *Node) Append(nn *Node, part string) {
 type File struct {
 	Dir string
 
-	data  *manifest.ManifestData
-	nodes map[string]*Node
-	cases map[string]string
-
-	currentNode     *Node
-	currentResource *manifest.ResourceData
-	currentCase     *manifest.CaseData
+	methods   []string
+	data      *manifest.ManifestData
+	diags     Diagnostics
+	nodes     map[string]*Node
+	cases     map[string]string
+	resources map[string]*manifest.ResourceData
+	caseDirs  map[string]*manifest.CaseData
+	dataFiles []string
+	refs      map[string]bool
 }
 
 func NewFile(dir string) *File {
@@ -86,75 +106,74 @@ func NewFile(dir string) *File {
 	return p
 }
 
+// Allows extension methods (e.g PROPFIND) in addition to the standard
+// http methods to be used in 'when' files
+func (p *File) RegisterMethods(methods ...string) error {
+	if err := validateMethods(methods); err != nil {
+		return err
+	}
+
+	p.methods = append(p.methods, methods...)
+	return nil
+}
+
 func (p *File) reset() {
 	root := NewNode()
 	p.data = &manifest.ManifestData{}
+	p.diags = Diagnostics{}
 	p.nodes = map[string]*Node{".": root}
 	p.cases = map[string]string{}
-	p.currentNode = root
-	p.currentResource = nil
-	p.currentCase = nil
+	p.resources = map[string]*manifest.ResourceData{}
+	p.caseDirs = map[string]*manifest.CaseData{}
+	p.dataFiles = []string{}
+	p.refs = map[string]bool{}
 }
 
 func (p *File) ParseHTTPMessage(r io.ReadCloser, fpath string) (string, http.Header, string, error) {
+	return ParseHTTPMessage(r, fpath)
+}
 
-	inbody := false
-	rline := ""
-	hlines := []string{}
-	body := ""
-	headers := make(http.Header)
-
-	s := bufio.NewScanner(r)
-	for s.Scan() {
-		if !inbody {
-			//first line should be the request line
-			if rline == "" {
-				rline = s.Text()
-				continue
-			}
+// if the body of a message only consists of a reference to a data file
+// (e.g '@body: then.json') the content of that file is returned instead, the
+// path is relative to the message file and has to stay in its case directory.
+// Unless specified explicitely the Content-Type header is inferred from the
+// data file's extension
+func (p *File) ParseBodyRef(body string, headers http.Header, fpath string, line int) (string, error) {
+	m := BodyRefEX.FindStringSubmatch(strings.TrimSpace(body))
+	if m == nil {
+		return body, nil
+	}
 
-			//empty line indicates that we will be parsing the body
-			if s.Text() == "" {
-				inbody = true
-				continue
-			}
+	ref := strings.TrimSpace(m[1])
+	dpath := filepath.Join(filepath.Dir(fpath), ref)
+	rel, err := filepath.Rel(filepath.Dir(fpath), dpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", UnexpectedBodyReferenceError(fpath, line, ref, fmt.Errorf("it is outside the case directory"))
+	}
 
-			//add as headers
-			hlines = append(hlines, s.Text())
-		} else {
-			//res is assumed to be body
-			body += s.Text()
-		}
+	data, err := ioutil.ReadFile(dpath)
+	if err != nil {
+		return "", UnexpectedBodyReferenceError(fpath, line, ref, err)
 	}
 
-	//check/parse header format
-	for _, h := range hlines {
-		hp := strings.SplitN(h, ":", 2)
-		if len(hp) != 2 {
-			return rline, headers, body, UnexpectedHeaderLineError(fpath, h)
-		}
+	p.refs[dpath] = true
 
-		headers.Add(http.CanonicalHeaderKey(hp[0]), strings.TrimSpace(hp[1]))
+	if headers.Get("Content-Type") == "" {
+		if ct := mime.TypeByExtension(filepath.Ext(ref)); ct != "" {
+			headers.Set("Content-Type", ct)
+		}
 	}
 
-	return rline, headers, body, nil
+	return string(data), nil
 }
 
 //check method format
 func (p *File) parseMethod(input string) (string, error) {
-	method := ""
-	for _, m := range ValidHTTPMethods {
-		if m == input {
-			method = m
-			break
-		}
-	}
-
-	if method == "" {
+	if !isMethod(input, p.methods) {
 		return "", fmt.Errorf("unexpected method %s", input)
 	}
 
-	return method, nil
+	return input, nil
 }
 
 func (p *File) parsePath(input string) (string, error) {
@@ -169,30 +188,47 @@ func (p *File) parsePath(input string) (string, error) {
 func (p *File) ParseWhen(r io.ReadCloser, fpath string) (*manifest.When, error) {
 	w := &manifest.When{}
 
-	rline, headers, body, err := p.ParseHTTPMessage(r, fpath)
+	m, err := readMessage(r, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = noDirectives(m, fpath)
 	if err != nil {
 		return nil, err
 	}
 
 	//request line should be 2 parts seperated by a space
-	rlinep := strings.SplitN(rline, " ", 2)
+	rlinep := strings.SplitN(m.Start, " ", 2)
 	if len(rlinep) != 2 {
-		return nil, UnexpectedRequestLineError(fpath, rline)
+		return nil, UnexpectedRequestLineError(fpath, m.StartLine, m.Start)
 	}
 
 	//get method
 	w.Method, err = p.parseMethod(rlinep[0])
 	if err != nil {
-		return nil, UnexpectedRequestLineMethodError(fpath, rlinep[0])
+		return nil, UnexpectedRequestLineMethodError(fpath, m.StartLine, rlinep[0], p.methods)
 	}
 
 	//check path
 	w.Path, err = p.parsePath(rlinep[1])
 	if err != nil {
-		return nil, UnexpectedRequestLinePathError(fpath, rlinep[1])
+		return nil, UnexpectedRequestLinePathError(fpath, m.StartLine, len(rlinep[0])+2, rlinep[1])
+	}
+
+	//query is stored apart from the path
+	w.Path, w.Query, err = splitQuery(w.Path)
+	if err != nil {
+		return nil, UnexpectedRequestLineQueryError(fpath, m.StartLine, len(rlinep[0])+strings.Index(rlinep[1], "?")+3, rlinep[1], err)
+	}
+
+	//body may be stored in a seperate file
+	body, err := p.ParseBodyRef(m.Body, m.Headers, fpath, m.BodyLine)
+	if err != nil {
+		return nil, err
 	}
 
-	w.Headers = headers
+	w.Headers = m.Headers
 	w.Body = body
 
 	return w, nil
@@ -200,39 +236,48 @@ func (p *File) ParseWhen(r io.ReadCloser, fpath string) (*manifest.When, error)
 
 // parses a then file loosely based on the format of a standard http message
 func (p *File) ParseThen(r io.ReadCloser, fpath string) (*manifest.Then, error) {
-	t := &manifest.Then{}
+	t, _, err := p.parseThen(r, fpath)
+	return t, err
+}
+
+// parses a then file and returns the timeout of the case it sets
+func (p *File) parseThen(r io.ReadCloser, fpath string) (*manifest.Then, string, error) {
 
 	//parse as a standard http message
-	rline, headers, body, err := p.ParseHTTPMessage(r, fpath)
+	m, err := readMessage(r, fpath)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	//response line should be 2 parts seperated by a space
-	rlinep := strings.SplitN(rline, " ", 2)
-	if len(rlinep) != 2 {
-		return nil, UnexpectedResponseLineError(fpath, rline)
+	t, timeout, err := newThen(m, fpath)
+	if err != nil {
+		return nil, "", err
 	}
 
-	//first one should be parseable as int
-	code, err := strconv.Atoi(rlinep[0])
+	//body may be stored in a seperate file
+	t.Body, err = p.ParseBodyRef(m.Body, m.Headers, fpath, m.BodyLine)
 	if err != nil {
-		return nil, UnexpectedResponseLineCodeError(fpath, rlinep[0], err)
+		return nil, "", err
 	}
 
-	t.StatusCode = code
-	t.Status = rlinep[1]
-	t.Headers = headers
-	t.Body = body
-	return t, nil
+	return t, timeout, nil
 }
 
-// parses a 'while' file
+// parses a 'while' file, duplicate links are dropped
 func (p *File) ParseWhile(r io.ReadCloser, fpath string) ([]manifest.While, error) {
+	ws, _, err := p.parseWhile(r, fpath)
+	return ws, err
+}
+
+// parses a 'while' file and returns a warning for every duplicate link
+func (p *File) parseWhile(r io.ReadCloser, fpath string) ([]manifest.While, []error, error) {
 	ws := []manifest.While{}
+	warns := []error{}
 
+	n := 0
 	s := bufio.NewScanner(r)
 	for s.Scan() {
+		n++
 
 		//dont mind empty lines
 		if strings.TrimSpace(s.Text()) == "" {
@@ -242,32 +287,43 @@ func (p *File) ParseWhile(r io.ReadCloser, fpath string) ([]manifest.While, erro
 		//every non-empty line should have space seperated link
 		wp := strings.SplitN(s.Text(), " ", 2)
 		if len(wp) != 2 {
-			return ws, UnexpectedLinkLineError(fpath, s.Text())
+			return ws, warns, UnexpectedLinkLineError(fpath, n, s.Text())
 		}
 
-		//create while for case
-		w := manifest.While{
-			ID: wp[0],
+		//a dependency can be expected to respond with multiple cases
+		cnames, off := splitCaseNames(strings.TrimRight(wp[1], " "))
+		if off >= 0 {
+			return ws, warns, UnexpectedLinkLineCaseNameError(fpath, n, len(wp[0])+2+off, wp[1])
 		}
 
-		cname := p.ToCaseName(strings.TrimSpace(wp[1]))
-		if cname == "" {
-			return ws, UnexpectedLinkLineError(fpath, s.Text())
+		//create while for each case
+		for _, cname := range cnames {
+			var ok bool
+			ws, ok = addWhile(ws, manifest.While{ID: wp[0], Case: cname})
+			if !ok {
+				warns = append(warns, DuplicateWhileWarning(fpath, n, 1, wp[0], cname))
+			}
 		}
-
-		w.Case = cname
-		ws = append(ws, w)
 	}
 
-	return ws, nil
+	return ws, warns, nil
 }
 
-// parses a 'given' file
+// parses a 'given' file, duplicate states are dropped
 func (p *File) ParseGiven(r io.ReadCloser, fpath string) (map[string]manifest.Given, error) {
+	gs, _, err := p.parseGiven(r, fpath)
+	return gs, err
+}
+
+// parses a 'given' file and returns a warning for every duplicate state
+func (p *File) parseGiven(r io.ReadCloser, fpath string) (map[string]manifest.Given, []error, error) {
 	gs := make(map[string]manifest.Given)
+	warns := []error{}
 
+	n := 0
 	s := bufio.NewScanner(r)
 	for s.Scan() {
+		n++
 
 		//dont mind empty lines
 		if strings.TrimSpace(s.Text()) == "" {
@@ -277,28 +333,31 @@ func (p *File) ParseGiven(r io.ReadCloser, fpath string) (map[string]manifest.Gi
 		//every non-empty line should have space seperated link
 		gp := strings.SplitN(s.Text(), ":", 2)
 		if len(gp) != 2 {
-			return gs, UnexpectedStateLineError(fpath, s.Text())
+			return gs, warns, UnexpectedStateLineError(fpath, n, s.Text())
 		}
 
 		//extract provider name
 		pname := strings.TrimSpace(gp[0])
 		if pname == "" {
-			return gs, UnexpectedStateLineError(fpath, s.Text())
+			return gs, warns, UnexpectedStateLineError(fpath, n, s.Text())
 		}
 
-		//extract state name as case name
-		sname := p.ToCaseName(strings.TrimSpace(gp[1]))
-		if sname == "" {
-			return gs, UnexpectedStateLineError(fpath, s.Text())
+		//extract state names as case names, a provider can be
+		//given multiple states on one line or on several
+		snames, off := splitCaseNames(strings.TrimSpace(gp[1]))
+		if off >= 0 {
+			return gs, warns, UnexpectedStateLineError(fpath, n, s.Text())
 		}
 
 		//set given
-		gs[pname] = manifest.Given{
-			Name: sname,
+		for _, sname := range snames {
+			if !addGiven(gs, pname, sname) {
+				warns = append(warns, DuplicateGivenWarning(fpath, n, 1, pname, sname))
+			}
 		}
 	}
 
-	return gs, nil
+	return gs, warns, nil
 }
 
 // Returns wether a given basename of a file path denotes a resource
@@ -332,8 +391,8 @@ func (p *File) enterResource(rel, fpath, part string) error {
 	var ok bool
 
 	//create and add new resource node
-	p.currentNode = NewNode()
-	p.nodes[rel] = p.currentNode
+	node := NewNode()
+	p.nodes[rel] = node
 
 	//get parent node
 	if parent, ok = p.nodes[filepath.Dir(rel)]; !ok {
@@ -341,20 +400,55 @@ func (p *File) enterResource(rel, fpath, part string) error {
 	}
 
 	//apprent to parent
-	parent.Append(p.currentNode, part)
+	parent.Append(node, part)
 
 	//use node structure to create and append resource to manifest
-	p.currentResource = &manifest.ResourceData{
-		Pattern: p.currentNode.Pattern,
+	res := &manifest.ResourceData{
+		Pattern: node.Pattern,
 		Cases:   []*manifest.CaseData{},
 	}
 
 	// add to manifest data
-	p.data.Resources = append(p.data.Resources, p.currentResource)
+	p.resources[rel] = res
+	p.data.Resources = append(p.data.Resources, res)
 	return nil
 }
 
+// parses an archetypes.json file
+func (p *File) loadArchetypes(fpath string) ([]*strategy.Archetype, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return strategy.LoadArchetypes(f)
+}
+
+// record a problem, errors that are not positioned are
+// attributed to the file as a whole
+func (p *File) report(sev Severity, fpath string, err error) {
+	p.diags = append(p.diags, NewDiagnostic(sev, fpath, err))
+}
+
 func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
+	err = p.visitPath(fpath, fi, err)
+	if err == nil || err == filepath.SkipDir {
+		return err
+	}
+
+	p.report(SeverityError, fpath, err)
+
+	//keep walking but dont descend into a directory that
+	//couldn't be parsed, its content would only add noise
+	if fi != nil && fi.IsDir() && fpath != p.Dir {
+		return filepath.SkipDir
+	}
+
+	return nil
+}
+
+func (p *File) visitPath(fpath string, fi os.FileInfo, err error) error {
 
 	//cancel walk if something went wrong
 	if err != nil {
@@ -374,7 +468,7 @@ func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
 		p.enterResource(rel, fpath, "/")
 
 		//check for archetype
-		atf, err := os.Open(filepath.Join(fpath, "archetypes.json"))
+		_, err = os.Stat(filepath.Join(fpath, "archetypes.json"))
 		if err != nil {
 			if os.IsNotExist(err) {
 				return nil
@@ -383,9 +477,15 @@ func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
 		}
 
 		//immediately parse it
-		p.data.Archetypes, err = strategy.LoadArchetypes(atf)
-		if err != nil {
-			return err
+		p.data.Archetypes, err = p.loadArchetypes(filepath.Join(fpath, "archetypes.json"))
+		return err
+	}
+
+	//hidden files and directories (e.g .gitkeep) are not part of the manifest
+	if strings.HasPrefix(fi.Name(), ".") {
+		p.report(SeverityWarning, fpath, IgnoredFileWarning(fpath))
+		if fi.IsDir() {
+			return filepath.SkipDir
 		}
 
 		return nil
@@ -394,38 +494,77 @@ func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
 	//directories are expected to be either resources or cases
 	if fi.IsDir() {
 		if part := p.ToResourcePatternPart(filepath.Base(rel)); part != "" {
-			p.enterResource(rel, fpath, part)
+			return p.enterResource(rel, fpath, part)
 		} else if cname := p.ToCaseName(filepath.Base(rel)); cname != "" {
 
-			//get current resource (if any)
-			res := p.currentResource
-			if res == nil {
-				return fmt.Errorf("Case folder '%s' (%s) is outside a resource", cname, fpath)
+			//get resource the case is in (if any)
+			res, ok := p.resources[filepath.Dir(rel)]
+			if !ok {
+				return CaseOutsideResourceError(fpath, cname)
 			}
 
 			//case name must be unique
 			if ex, ok := p.cases[cname]; ok {
-				return fmt.Errorf("Case with name '%s' (%s) already exists in '%s'", cname, fpath, filepath.Dir(ex))
+				return DuplicateCaseError(fpath, cname, filepath.Dir(ex))
 			}
 
 			//create the case from available data
-			p.currentCase = &manifest.CaseData{
+			c := &manifest.CaseData{
 				Name: cname,
 				When: manifest.When{},
 				Then: manifest.Then{},
 			}
 
 			//and append to resource
-			res.Cases = append(res.Cases, p.currentCase)
+			res.Cases = append(res.Cases, c)
 			p.cases[cname] = fpath
+			p.caseDirs[rel] = c
 		} else {
-			return UnexpectedDirError(fi)
+			return UnexpectedDirError(fpath, fi)
 		}
 	} else {
 
+		//archetypes of the root are loaded when it is entered, others
+		//are scoped to the resource or case they are in
+		if fi.Name() == "archetypes.json" {
+			dir := filepath.Dir(rel)
+			if fpath == filepath.Join(p.Dir, "archetypes.json") {
+				return nil
+			} else if res, ok := p.resources[dir]; ok {
+				res.Archetypes, err = p.loadArchetypes(fpath)
+				return err
+			} else if c, ok := p.caseDirs[dir]; ok {
+				c.Archetypes, err = p.loadArchetypes(fpath)
+				return err
+			}
+		}
+
+		//a readme has prose about the resource or case it is in
+		if isReadme(fi.Name()) {
+			dir := filepath.Dir(rel)
+			res, isRes := p.resources[dir]
+			c, isCase := p.caseDirs[dir]
+			if isRes || isCase {
+				text, err := ioutil.ReadFile(fpath)
+				if err != nil {
+					return err
+				}
+
+				summary, desc, tags := splitProse(readmeParagraphs(string(text)))
+				if isRes {
+					res.Summary, res.Description, res.Tags = summary, desc, tags
+				} else {
+					c.Summary, c.Description, c.Tags = summary, desc, tags
+				}
+
+				return nil
+			}
+		}
+
 		//case files outside a case
-		if p.currentCase == nil {
-			return fmt.Errorf("Case file '%s' was found outside a case folder", fpath)
+		c, ok := p.caseDirs[filepath.Dir(rel)]
+		if !ok {
+			return FileOutsideCaseError(fpath)
 		}
 
 		//files without extension have to be either when/then/given/while
@@ -439,39 +578,54 @@ func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
 
 			//'keywords;
 			if filepath.Base(fpath) == "given" {
-				given, err := p.ParseGiven(f, fpath)
+				given, warns, err := p.parseGiven(f, fpath)
 				if err != nil {
 					return err
 				}
 
-				p.currentCase.Given = given
+				for _, w := range warns {
+					p.report(SeverityWarning, fpath, w)
+				}
+
+				if len(given) == 0 {
+					p.report(SeverityWarning, fpath, EmptyGivenWarning(fpath))
+				}
+
+				c.Given = given
 			} else if filepath.Base(fpath) == "when" {
 				when, err := p.ParseWhen(f, fpath)
 				if err != nil {
 					return err
 				}
 
-				p.currentCase.When = *when
+				c.When = *when
 			} else if filepath.Base(fpath) == "then" {
-				then, err := p.ParseThen(f, fpath)
+				then, timeout, err := p.parseThen(f, fpath)
 				if err != nil {
 					return err
 				}
 
-				p.currentCase.Then = *then
+				c.Then = *then
+				c.Timeout = timeout
 			} else if filepath.Base(fpath) == "while" {
-				whiles, err := p.ParseWhile(f, fpath)
+				whiles, warns, err := p.parseWhile(f, fpath)
 				if err != nil {
 					return err
 				}
 
-				p.currentCase.While = whiles
+				for _, w := range warns {
+					p.report(SeverityWarning, fpath, w)
+				}
+
+				c.While = whiles
 			} else {
-				return UnexpectedFileError(fi)
+				return UnexpectedFileError(fpath, fi)
 			}
 
 		} else {
-			//@todo parse data files
+			//data files (e.g then.json) are read when a when/then
+			//references them, see ParseBodyRef
+			p.dataFiles = append(p.dataFiles, fpath)
 		}
 
 	}
@@ -479,17 +633,42 @@ func (p *File) visit(fpath string, fi os.FileInfo, err error) error {
 	return nil
 }
 
-func (p *File) Parse() (*manifest.ManifestData, error) {
+// Parses the directory but doesn't stop at the first problem, instead
+// the (partial) manifest data is returned with everything that was
+// found wrong along the way
+func (p *File) ParseAll() (*manifest.ManifestData, Diagnostics) {
 
 	//reset parser afterwards
 	defer p.reset()
 
-	//walk nodes
-	err := filepath.Walk(p.Dir, p.visit)
-	if err != nil {
+	//walk nodes, errors are reported by the visitor
+	filepath.Walk(p.Dir, p.visit)
+
+	//data files no message referred to
+	for _, fpath := range p.dataFiles {
+		if !p.refs[fpath] {
+			p.report(SeverityWarning, fpath, IgnoredFileWarning(fpath))
+		}
+	}
+
+	//cases that dont describe a response
+	for _, res := range p.data.Resources {
+		for _, c := range res.Cases {
+			if c.Then.StatusCode == 0 {
+				p.report(SeverityWarning, p.cases[c.Name], MissingThenWarning(p.cases[c.Name], c.Name))
+			}
+		}
+	}
+
+	return p.data, p.diags
+}
+
+func (p *File) Parse() (*manifest.ManifestData, error) {
+	data, diags := p.ParseAll()
+	if err := diags.Err(); err != nil {
 		return nil, err
 	}
 
 	//return result
-	return p.data, nil
+	return data, nil
 }
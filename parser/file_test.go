@@ -1,11 +1,19 @@
 package parser_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/dockpit/assert/strategy"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/dockpit/lang/manifest"
 	"github.com/dockpit/lang/parser"
 )
 
@@ -52,3 +60,368 @@ func TestParseNotes(t *testing.T) {
 	assert.Equal(t, "github.com/dockpit/ex-store-orders", md.Resources[1].Cases[1].While[0].ID)
 	assert.Equal(t, "list all orders", md.Resources[1].Cases[1].While[0].Case)
 }
+
+func TestParseDataFiles(t *testing.T) {
+	p := parser.NewFile(filepath.Join(".example_files", "note_service"))
+
+	md, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c *manifest.CaseData
+	for _, res := range md.Resources {
+		for _, rc := range res.Cases {
+			if rc.Name == "notes as json" {
+				c = rc
+			}
+		}
+	}
+
+	if c == nil {
+		t.Fatal("expected case 'notes as json' to be parsed")
+	}
+
+	//body should be read from then.json and content type inferred
+	assert.Equal(t, "[\n  {\"id\": \"1\", \"title\": \"groceries\"},\n  {\"id\": \"2\", \"title\": \"todo\"}\n]\n", c.Then.Body)
+	assert.Equal(t, "application/json", c.Then.Headers.Get("Content-Type"))
+}
+
+func TestParseBodyRefOutsideCase(t *testing.T) {
+	p := parser.NewFile(filepath.Join(".example_files", "note_service"))
+	fpath := filepath.Join(".example_files", "note_service", "- notes", "'notes as json'", "then")
+
+	_, err := p.ParseBodyRef("@body: ../../../../file_test.go", http.Header{}, fpath, 3)
+
+	var perr *parser.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a parse error, got: %v", err)
+	}
+
+	assert.Equal(t, parser.ErrBodyReference, perr.Code)
+	assert.Equal(t, 3, perr.Line)
+	assert.Contains(t, perr.Error(), "outside the case directory")
+}
+
+// writes files to a temporary directory, paths are slash separated
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "dockpit_parser_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(fpath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestParseAllDiagnostics(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"- notes/'list of notes'/when":      "GET /notes\n",
+		"- notes/'list of notes'/then":      "200 OK\n",
+		"- notes/'list of notes'/seed.csv":  "id,title\n",
+		"- notes/'broken when'/when":        "GET notes\n",
+		"- notes/'broken when'/then":        "200 OK\n",
+		"- notes/'broken then'/when":        "GET /notes\n",
+		"- notes/'broken then'/then":        "OK\n",
+		"- notes/'no then'/given":           "\n",
+		"- notes/'no then'/when":            "GET /notes\n",
+		"- notes/- (note_id)/'a note'/when": "GET /notes/1\n",
+		"- notes/- (note_id)/'a note'/then": "200 OK\n",
+	})
+	defer os.RemoveAll(dir)
+
+	md, diags := parser.NewFile(dir).ParseAll()
+
+	//all cases should be parsed as far as possible
+	assert.Len(t, md.Resources, 3)
+	assert.Len(t, md.Resources[1].Cases, 4)
+	assert.Len(t, md.Resources[2].Cases, 1)
+
+	codes := map[parser.ErrorCode]parser.Severity{}
+	for _, d := range diags {
+		codes[d.Code] = d.Severity
+	}
+
+	assert.Len(t, diags.Filter(parser.SeverityError), 2)
+	assert.Equal(t, parser.SeverityError, codes[parser.ErrRequestLinePath])
+	assert.Equal(t, parser.SeverityError, codes[parser.ErrResponseLine])
+	assert.Equal(t, parser.SeverityWarning, codes[parser.WarnIgnoredFile])
+	assert.Equal(t, parser.SeverityWarning, codes[parser.WarnEmptyGiven])
+	assert.Equal(t, parser.SeverityWarning, codes[parser.WarnMissingThen])
+
+	//strict parsing should fail with the first error
+	_, err := parser.NewFile(dir).Parse()
+	assert.Equal(t, diags.Err().Error(), err.Error())
+}
+
+func TestParseMethods(t *testing.T) {
+	files := map[string]string{}
+	for cname, method := range map[string]string{"'patch a note'": "PATCH", "'head of notes'": "HEAD", "'note options'": "OPTIONS", "'note properties'": "PROPFIND"} {
+		files["- notes/"+cname+"/when"] = method + " /notes\n"
+	}
+
+	dir := writeTree(t, files)
+	defer os.RemoveAll(dir)
+
+	//extension methods are unknown unless registered
+	_, err := parser.NewFile(dir).Parse()
+	assert.Error(t, err)
+
+	p := parser.NewFile(dir)
+	assert.Error(t, p.RegisterMethods("PROP FIND"))
+	assert.NoError(t, p.RegisterMethods("PROPFIND"))
+
+	md, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := []string{}
+	for _, c := range md.Resources[1].Cases {
+		methods = append(methods, c.When.Method)
+	}
+
+	assert.Equal(t, []string{"HEAD", "OPTIONS", "PROPFIND", "PATCH"}, methods)
+
+	//registered methods are expected as well
+	_, err = p.ParseWhen(ioutil.NopCloser(strings.NewReader("BREW /notes\n")), "when")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "TRACE PROPFIND]")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	p := parser.NewFile(filepath.Join(".example_files", "note_service"))
+
+	md, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//query should be split from the path
+	c := md.Resources[1].Cases[0]
+	assert.Equal(t, "filtered list of notes", c.Name)
+	assert.Equal(t, "/notes", c.When.Path)
+	assert.Equal(t, url.Values{"test": []string{"x"}}, c.When.Query)
+	assert.Nil(t, md.Resources[1].Cases[1].When.Query)
+}
+
+func TestParseThenStatusRanges(t *testing.T) {
+	p := parser.NewFile(".")
+
+	then, err := p.ParseThen(ioutil.NopCloser(strings.NewReader("200|204 OK\n")), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 200, then.StatusCode)
+	assert.Equal(t, []manifest.StatusRange{{Min: 200, Max: 200}, {Min: 204, Max: 204}}, then.StatusCodes)
+
+	then, err = p.ParseThen(ioutil.NopCloser(strings.NewReader("4xx Client Error\n")), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 400, then.StatusCode)
+	assert.Equal(t, []manifest.StatusRange{{Min: 400, Max: 499}}, then.StatusCodes)
+
+	//exact codes are not kept as ranges
+	then, err = p.ParseThen(ioutil.NopCloser(strings.NewReader("201 Created\n")), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 201, then.StatusCode)
+	assert.Nil(t, then.StatusCodes)
+
+	_, err = p.ParseThen(ioutil.NopCloser(strings.NewReader("2x0 OK\n")), "then")
+	if perr, ok := err.(*parser.ParseError); assert.True(t, ok) {
+		assert.Equal(t, parser.ErrResponseLineCode, perr.Code)
+	}
+}
+
+func TestParseThenDirectives(t *testing.T) {
+	p := parser.NewFile(".")
+
+	then, err := p.ParseThen(ioutil.NopCloser(strings.NewReader("200 OK\nContent-Type: application/json\n@expect: $.id @present\n@ignore: $.created_at\n\n{}\n")), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"$.id @present"}, then.Expect)
+	assert.Equal(t, []string{"$.created_at"}, then.Ignore)
+	assert.Equal(t, 1, len(then.Headers))
+
+	then, err = p.ParseThen(ioutil.NopCloser(strings.NewReader("200 OK\n@headers: strict\n@ignore-header: x-request-id\n")), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(manifest.HeadersStrict), then.HeaderMode)
+	assert.Equal(t, []string{"X-Request-Id"}, then.IgnoreHeaders)
+	assert.Equal(t, 0, len(then.Headers))
+
+	//the timeout is for the whole case
+	dir := writeTree(t, map[string]string{
+		"- notes/'list of notes'/when": "GET /notes\n",
+		"- notes/'list of notes'/then": "200 OK\n@timeout: 1500ms\n",
+	})
+	defer os.RemoveAll(dir)
+
+	md, err := parser.NewFile(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "1500ms", md.Resources[1].Cases[0].Timeout)
+
+	//invalid paths and directives in when files are reported
+	for _, c := range []struct {
+		then bool
+		msg  string
+	}{
+		{true, "200 OK\n@expect: id @present\n"},
+		{true, "200 OK\n@ignore: $.items[x]\n"},
+		{false, "GET /notes\n@ignore: $.id\n"},
+		{true, "200 OK\n@headers: exact\n"},
+		{true, "200 OK\n@ignore-header: X-Request-Id Date\n"},
+		{false, "GET /notes\n@headers: strict\n"},
+		{true, "200 OK\n@timeout: soon\n"},
+		{true, "200 OK\n@timeout: -1s\n"},
+	} {
+		if c.then {
+			_, err = p.ParseThen(ioutil.NopCloser(strings.NewReader(c.msg)), "then")
+		} else {
+			_, err = p.ParseWhen(ioutil.NopCloser(strings.NewReader(c.msg)), "when")
+		}
+
+		if perr, ok := err.(*parser.ParseError); assert.True(t, ok, c.msg) {
+			assert.Equal(t, parser.ErrDirective, perr.Code)
+			assert.Equal(t, 2, perr.Line)
+		}
+	}
+}
+
+func TestParseScopedArchetypes(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"archetypes.json":                         `[{"value": "root"}]`,
+		"- notes/archetypes.json":                 `[{"value": "notes"}]`,
+		"- notes/'list of notes'/when":            "GET /notes\n",
+		"- notes/'list of notes'/then":            "200 OK\n",
+		"- notes/'list of notes'/archetypes.json": `[{"value": "list"}, {"value": "other"}]`,
+		"- notes/'no notes'/when":                 "GET /notes\n",
+		"- notes/'no notes'/then":                 "200 OK\n",
+	})
+	defer os.RemoveAll(dir)
+
+	md, err := parser.NewFile(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, md.Archetypes, 1)
+	assert.Len(t, md.Resources[0].Archetypes, 0)
+	assert.Len(t, md.Resources[1].Archetypes, 1)
+	assert.Len(t, md.Resources[1].Cases[0].Archetypes, 2)
+	assert.Len(t, md.Resources[1].Cases[1].Archetypes, 0)
+
+	//inner scopes come first
+	m, err := manifest.NewManifest(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := m.Resources()
+	as, _ := res[1].Actions()
+	pairs := as[0].Pairs()
+	assert.Equal(t, []*strategy.Archetype{
+		md.Resources[1].Cases[0].Archetypes[0],
+		md.Resources[1].Cases[0].Archetypes[1],
+		md.Resources[1].Archetypes[0],
+		md.Archetypes[0],
+	}, pairs[0].Archetypes)
+	assert.Len(t, pairs[1].Archetypes, 2)
+}
+
+func TestParseMultipleCases(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"- notes/'list of notes'/when":  "GET /notes\n",
+		"- notes/'list of notes'/then":  "200 OK\n",
+		"- notes/'list of notes'/given": "mysql: 'users', 'notes'\nredis: 'empty'\nmysql: 'users'\n",
+		"- notes/'list of notes'/while": "pit-token 'authorized', 'expired'\npit-token 'authorized'\n",
+	})
+	defer os.RemoveAll(dir)
+
+	md, diags := parser.NewFile(dir).ParseAll()
+	if assert.Len(t, diags, 2) {
+		assert.Equal(t, parser.WarnDuplicateGiven, diags[0].Code)
+		assert.Equal(t, 3, diags[0].Line)
+		assert.Equal(t, parser.WarnDuplicateWhile, diags[1].Code)
+		assert.Equal(t, 2, diags[1].Line)
+	}
+
+	c := md.Resources[1].Cases[0]
+	assert.Equal(t, []string{"users", "notes"}, c.Given["mysql"].States())
+	assert.Equal(t, []string{"empty"}, c.Given["redis"].States())
+	assert.Equal(t, []manifest.While{
+		{ID: "pit-token", Case: "authorized"},
+		{ID: "pit-token", Case: "expired"},
+	}, c.While)
+
+	//parsing a file directly doesnt leak warnings into a parse of the tree
+	p := parser.NewFile(dir)
+	ws, err := p.ParseWhile(ioutil.NopCloser(strings.NewReader("pit-token 'expired', 'expired'\n")), "while")
+	assert.NoError(t, err)
+	assert.Len(t, ws, 1)
+
+	_, diags = p.ParseAll()
+	assert.Len(t, diags, 2)
+
+	//every name has to be quoted
+	dir = writeTree(t, map[string]string{
+		"- notes/'list of notes'/when":  "GET /notes\n",
+		"- notes/'list of notes'/then":  "200 OK\n",
+		"- notes/'list of notes'/while": "pit-token 'authorized', expired\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags = parser.NewFile(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrLinkLineCaseName, diags[0].Code)
+		assert.Equal(t, 25, diags[0].Column)
+	}
+}
+
+func TestParseReadmes(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"- notes/README.md":              "# Notes\n\nNotes of users.\n\nThey are kept\nforever.\n\ntags: notes, storage\n",
+		"- notes/'list of notes'/README": "Lists all notes, newest first.\n",
+		"- notes/'list of notes'/when":   "GET /notes\n",
+		"- notes/'list of notes'/then":   "200 OK\n",
+	})
+	defer os.RemoveAll(dir)
+
+	md, err := parser.NewFile(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := md.Resources[1]
+	assert.Equal(t, "Notes of users.", res.Summary)
+	assert.Equal(t, "They are kept\nforever.", res.Description)
+	assert.Equal(t, []string{"notes", "storage"}, res.Tags)
+	assert.Equal(t, "Lists all notes, newest first.", res.Cases[0].Summary)
+	assert.Equal(t, "", res.Cases[0].Description)
+}
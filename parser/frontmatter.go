@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dockpit/lang/manifest"
+)
+
+func FrontMatterError(fpath string, line int, giv, format string, args ...interface{}) error {
+	return newParseError(fpath, line, 1, ErrFrontMatter, giv, format, args...)
+}
+
+func UnknownFrontMatterWarning(fpath string, line int, key string) error {
+	return newParseError(fpath, line, 1, WarnUnknownFrontMatter, key, "unknown key '%s' in front matter is ignored, expected one of: name, version, owners, base_path, headers", key)
+}
+
+func ConflictingFrontMatterError(fpath string, line int, key, val, other, otherpath string) error {
+	return newParseError(fpath, line, 1, ErrFrontMatterConflict, key, "front matter sets '%s' to '%s' but '%s' sets it to '%s'", key, val, otherpath, other)
+}
+
+// a value in the front matter of a page and the line it is on
+type matterField struct {
+	line  int
+	value string
+	list  []string
+	table http.Header
+}
+
+// Metadata at the top of a markdown page, either YAML between '---' lines
+// or TOML between '+++' lines. Only a subset of both is understood:
+//
+//	---
+//	name: users
+//	version: 1.2.0
+//	owners: [alice, bob]
+//	base_path: /api
+//	headers:
+//	  Accept: application/json
+//	---
+type frontMatter struct {
+	fields map[string]*matterField
+	order  []string
+}
+
+func (fm *frontMatter) set(key string, f *matterField) {
+	if _, ok := fm.fields[key]; !ok {
+		fm.order = append(fm.order, key)
+	}
+
+	fm.fields[key] = f
+}
+
+// strips quotes of YAML and TOML strings
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if uq, err := strconv.Unquote(s); err == nil {
+			return uq
+		}
+	}
+
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// parses an inline list, e.g: [alice, "bob"]
+func parseInlineList(s string) ([]string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, false
+	}
+
+	list := []string{}
+	for _, el := range strings.Split(s[1:len(s)-1], ",") {
+		if el = unquote(el); el != "" {
+			list = append(list, el)
+		}
+	}
+
+	return list, true
+}
+
+// Splits the front matter from the page, the returned number of bytes
+// belong to the front matter. Pages without it return nil
+func parseFrontMatter(md []byte, fpath string) (*frontMatter, int, error) {
+	delim := ""
+	consumed := 0
+	for _, d := range []string{"---", "+++"} {
+		for _, eol := range []string{"\n", "\r\n"} {
+			if bytes.HasPrefix(md, []byte(d+eol)) {
+				delim, consumed = d, len(d+eol)
+			}
+		}
+	}
+
+	if delim == "" {
+		return nil, 0, nil
+	}
+
+	fm := &frontMatter{fields: map[string]*matterField{}}
+	var table *matterField
+	n := 1
+
+	//lines may end with '\r\n', the scanner drops both
+	s := bufio.NewScanner(bytes.NewReader(md[consumed:]))
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		adv, tok, err := bufio.ScanLines(data, atEOF)
+		consumed += adv
+		return adv, tok, err
+	})
+
+	for s.Scan() {
+		n++
+		text := s.Text()
+		trimmed := strings.TrimSpace(text)
+
+		//closing delimiter, the rest is the page
+		if trimmed == delim {
+			return fm, consumed, nil
+		}
+
+		//dont mind empty lines and comments
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if delim == "+++" {
+
+			//toml: tables and 'key = value'
+			if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+				table = &matterField{line: n, table: http.Header{}}
+				fm.set(strings.TrimSpace(trimmed[1:len(trimmed)-1]), table)
+				continue
+			}
+
+			kv := strings.SplitN(trimmed, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, 0, FrontMatterError(fpath, n, text, "unexpected line in front matter: %s, expected format \"<key> = <value>\"", text)
+			}
+
+			key, val := unquote(kv[0]), strings.TrimSpace(kv[1])
+			if table != nil {
+				table.table.Add(key, unquote(val))
+			} else if list, ok := parseInlineList(val); ok {
+				fm.set(key, &matterField{line: n, list: list})
+			} else {
+				fm.set(key, &matterField{line: n, value: unquote(val)})
+			}
+
+			continue
+		}
+
+		//yaml: 'key: value', indented lines belong to the key before
+		indented := strings.TrimLeft(text, " \t") != text
+		if indented {
+			if table == nil {
+				return nil, 0, FrontMatterError(fpath, n, text, "unexpected indentation in front matter: %s", text)
+			}
+
+			if strings.HasPrefix(trimmed, "- ") {
+				table.list = append(table.list, unquote(trimmed[2:]))
+				continue
+			}
+
+			kv := strings.SplitN(trimmed, ":", 2)
+			if len(kv) != 2 {
+				return nil, 0, FrontMatterError(fpath, n, text, "unexpected line in front matter: %s, expected format \"<key>: <value>\" or \"- <value>\"", text)
+			}
+
+			if table.table == nil {
+				table.table = http.Header{}
+			}
+
+			table.table.Add(strings.TrimSpace(kv[0]), unquote(kv[1]))
+			continue
+		}
+
+		kv := strings.SplitN(trimmed, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, 0, FrontMatterError(fpath, n, text, "unexpected line in front matter: %s, expected format \"<key>: <value>\"", text)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		table = nil
+		if val == "" {
+			table = &matterField{line: n}
+			fm.set(key, table)
+		} else if list, ok := parseInlineList(val); ok {
+			fm.set(key, &matterField{line: n, list: list})
+		} else {
+			fm.set(key, &matterField{line: n, value: unquote(val)})
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, 0, FrontMatterError(fpath, n+1, delim, "failed to read front matter: %s", err)
+	}
+
+	return nil, 0, FrontMatterError(fpath, 1, delim, "front matter is not closed, expected a line with '%s'", delim)
+}
+
+// Merges the front matter of a page into the manifest data, a value that
+// was already set by another page has to be the same. The page that set
+// a value is recorded in origins by key, other keys (e.g for a static
+// site generator) are ignored with a warning
+func (fm *frontMatter) merge(data *manifest.ManifestData, origins map[string]string, fpath string) Diagnostics {
+	diags := Diagnostics{}
+	report := func(err error) {
+		diags = append(diags, NewDiagnostic(SeverityError, fpath, err))
+	}
+
+	//sets a value unless a different one was set before
+	set := func(key string, f *matterField, dst *string, val string) {
+		if f.value == "" {
+			report(FrontMatterError(fpath, f.line, key, "'%s' in front matter is not a single value", key))
+		} else if *dst != "" && *dst != val {
+			report(ConflictingFrontMatterError(fpath, f.line, key, val, *dst, origins[key]))
+		} else {
+			*dst = val
+			origins[key] = fpath
+		}
+	}
+
+	for _, key := range fm.order {
+		f := fm.fields[key]
+		switch key {
+		case "name":
+			set(key, f, &data.Name, f.value)
+		case "version":
+			set(key, f, &data.Version, f.value)
+		case "base_path":
+			if f.value != "" && !path.IsAbs(f.value) {
+				report(FrontMatterError(fpath, f.line, f.value, "base path '%s' in front matter is not absolute, expected it to start with '/'", f.value))
+				continue
+			}
+
+			set(key, f, &data.BasePath, path.Clean("/"+f.value))
+		case "owners":
+			owners := f.list
+			if f.value != "" {
+				owners = []string{f.value}
+			}
+
+			joined, other := strings.Join(owners, ", "), strings.Join(data.Owners, ", ")
+			if other != "" && other != joined {
+				report(ConflictingFrontMatterError(fpath, f.line, key, joined, other, origins[key]))
+				continue
+			}
+
+			data.Owners = owners
+			origins[key] = fpath
+		case "headers":
+			if f.table == nil {
+				report(FrontMatterError(fpath, f.line, key, "'headers' in front matter is not a map of header names to values"))
+				continue
+			}
+
+			if data.Headers == nil {
+				data.Headers = http.Header{}
+			}
+
+			hkeys := []string{}
+			for hkey := range f.table {
+				hkeys = append(hkeys, hkey)
+			}
+
+			sort.Strings(hkeys)
+			for _, hkey := range hkeys {
+				val := strings.Join(f.table[hkey], ", ")
+				if other := strings.Join(data.Headers[hkey], ", "); other != "" && other != val {
+					report(ConflictingFrontMatterError(fpath, f.line, "headers."+hkey, val, other, origins["headers."+hkey]))
+					continue
+				}
+
+				data.Headers[hkey] = f.table[hkey]
+				origins["headers."+hkey] = fpath
+			}
+		default:
+			diags = append(diags, NewDiagnostic(SeverityWarning, fpath, UnknownFrontMatterWarning(fpath, f.line, key)))
+		}
+	}
+
+	return diags
+}
@@ -3,7 +3,11 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -11,9 +15,9 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 
+	"github.com/dockpit/assert/strategy"
 	"github.com/dockpit/lang/manifest"
 
 	"github.com/russross/blackfriday"
@@ -24,103 +28,194 @@ var VariableExp = regexp.MustCompile(`(\(.*?\))`)
 var CaseExp = regexp.MustCompile(`^'(.*)'$`)
 var WhenExp = regexp.MustCompile(`^when:$`)
 var ThenExp = regexp.MustCompile(`^then:$`)
-var GivenStateExp = regexp.MustCompile(`^(.*).*has:.*'(.*)'.*$`)
-var GivenDepExp = regexp.MustCompile(`^(.*).*responds:.*'(.*)'.*$`)
+var GivenStateExp = regexp.MustCompile(`^(.*?)\s*has:\s*('.*')\s*$`)
+var GivenDepExp = regexp.MustCompile(`^(.*?)\s*responds:\s*('.*')\s*$`)
+
+//a dependency given line in rendered html
+var GivenDepLinkExp = regexp.MustCompile(`([^\s<>]+)(\s+responds:\s+)('.*')`)
+
+func UnexpectedGivenLineError(fpath string, line, col int, giv string) error {
+	return newParseError(fpath, line, col, ErrGivenLine, giv, "unexpected line in given: %s, expected format \"<state provider> has: '<state name>'\" or \"<service id> responds: '<case name>'\"", giv)
+}
+
+func CaseOutsideResourceHeaderError(fpath string, line, col int, cname string) error {
+	return newParseError(fpath, line, col, ErrCaseOutsideResource, cname, "case '%s' is outside a resource, expected a level 1 header with a path first", cname)
+}
+
+func DuplicateCaseHeaderError(fpath string, line, col int, cname, pattern string) error {
+	return newParseError(fpath, line, col, ErrDuplicateCase, cname, "case with name '%s' already exists in resource '%s', case names are used as anchors and have to be unique", cname, pattern)
+}
+
+func DuplicateCaseAnchorError(fpath string, line, col int, cname, other, pattern string) error {
+	return newParseError(fpath, line, col, ErrDuplicateAnchor, cname, "case '%s' has the same anchor '%s' as case '%s' in resource '%s', links would go to either", cname, CaseAnchor(cname), other, pattern)
+}
+
+func StatementOutsideCaseError(fpath string, line, col int, stmt string) error {
+	return newParseError(fpath, line, col, ErrStatementOutsideCase, stmt, "encountered '%s' outside case", stmt)
+}
+
+func InvalidArchetypesError(fpath string, line, col int, err error) error {
+	return newParseError(fpath, line, col, ErrArchetypes, "archetypes", "invalid archetypes block: %s", err)
+}
+
+func DuplicateStatementError(fpath string, line, col int, stmt string) error {
+	return newParseError(fpath, line, col, ErrDuplicateStatement, stmt, "encountered multiple '%s' statements in example", stmt)
+}
+
+func MissingStatementBlockError(fpath string, line, col int, stmt string) error {
+	return newParseError(fpath, line, col, ErrMissingBlock, stmt, "'%s:' is not followed by a code block with the message", stmt)
+}
+
+func UnexpectedBlockLangError(fpath string, line, col int, stmt, lang string) error {
+	expected := "'http'"
+	if stmt == "then" {
+		expected = "'http' or 'http-response'"
+	}
+
+	return newParseError(fpath, line, col, ErrBlockLang, lang, "unexpected '%s' block after '%s:', expected an untagged block or one tagged %s", lang, stmt, expected)
+}
+
+func DuplicateBodyError(fpath string, line, col int, stmt, lang string) error {
+	return newParseError(fpath, line, col, ErrDuplicateBody, lang, "'%s' block is a body for '%s:' but its message already has one", lang, stmt)
+}
+
+// Content types of bodies in fenced blocks, by the language tag. A tagged
+// block that directly follows the message of a when or then is its body
+var BlockContentTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml",
+}
 
 // A markdown to html rendered that stores
 // a JSON structure for
-// @todo add line numbers to errors
 type withJSON struct {
 	blackfriday.Renderer
 	Manifest *manifest.ManifestData
-	Errors   chan (error)
+	Diags    Diagnostics
+
+	fpath   string
+	source  []byte
+	offset  int
+	methods []string
 
 	openResource *manifest.ResourceData
 	openCase     *manifest.CaseData
 
+	//statements of the open case, the one whose message is expected in the
+	//next code block, where its heading is and which may still get a body
+	stated     map[string]bool
+	expecting  string
+	expectLine int
+	expectCol  int
+	bodyFor    string
+
+	//top level paragraphs since the last resource or case heading,
+	//others (e.g in a quote) are written to different buffers
+	doc   *bytes.Buffer
+	prose []string
+
+	//links to dependencies by the placeholder they are written as
+	nonce string
+	links map[string]depLink
+
 	recorder             *bytes.Buffer
 	lastParagraph        []byte
 	lastTextBeforeMarker int
 	lastTextAfterMarker  int
 }
 
-func renderer(md *manifest.ManifestData) *withJSON {
+func renderer(md *manifest.ManifestData, fpath string, source []byte, methods []string) *withJSON {
 	return &withJSON{
 		Renderer: blackfriday.HtmlRenderer(0, "", ""),
 		Manifest: md,
-		Errors:   make(chan error),
+		Diags:    Diagnostics{},
+		fpath:    fpath,
+		source:   source,
+		methods:  methods,
+		stated:   map[string]bool{},
+		nonce:    newNonce(),
+		links:    map[string]depLink{},
 	}
 }
 
-func (r *withJSON) record() {
-	r.recorder = bytes.NewBuffer(nil)
+// a random token, content of a page doesn't contain it by chance
+func newNonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-func (r *withJSON) rewind() []byte {
-	b := r.recorder.Bytes()
-	r.recorder = nil
-	return b
+func (r *withJSON) report(sev Severity, err error) {
+	r.Diags = append(r.Diags, NewDiagnostic(sev, r.fpath, err))
 }
 
-func (p *withJSON) ParseHTTPMessage(r io.ReadCloser, fpath string) (string, http.Header, string, error) {
-
-	inbody := false
-	rline := ""
-	hlines := []string{}
-	body := ""
-	headers := make(http.Header)
+// Returns the line and column at which the (first line of) text is found
+// in the markdown source. The renderer only receives the content, so the
+// search continues after the previous one to keep repeated text (e.g the same
+// request in multiple cases) in order. Zero is returned if it can't be found
+func (r *withJSON) locate(text string) (int, int) {
+	needle := ""
+	for _, l := range strings.Split(text, "\n") {
+		if needle = strings.TrimSpace(l); needle != "" {
+			break
+		}
+	}
 
-	s := bufio.NewScanner(r)
-	for s.Scan() {
-		if !inbody {
-			//first line should be the request line
-			if rline == "" {
-				rline = s.Text()
-				continue
-			}
+	if needle == "" {
+		return 0, 0
+	}
 
-			//empty line indicates that we will be parsing the body
-			if s.Text() == "" {
-				inbody = true
-				continue
-			}
+	idx := bytes.Index(r.source[r.offset:], []byte(needle))
+	if idx < 0 {
 
-			//add as headers
-			hlines = append(hlines, s.Text())
-		} else {
-			//res is assumed to be body
-			body += s.Text()
+		//rendered text may have lost markup (e.g links), try the first word
+		needle = strings.Fields(needle)[0]
+		idx = bytes.Index(r.source[r.offset:], []byte(needle))
+		if idx < 0 {
+			return 0, 0
 		}
 	}
 
-	//check/parse header format
-	for _, h := range hlines {
-		hp := strings.SplitN(h, ":", 2)
-		if len(hp) != 2 {
-			return rline, headers, body, UnexpectedHeaderLineError(fpath, h)
-		}
+	idx += r.offset
+	r.offset = idx + len(needle)
+
+	start := bytes.LastIndex(r.source[:idx], []byte("\n")) + 1
+	return bytes.Count(r.source[:idx], []byte("\n")) + 1, idx - start + 1
+}
 
-		headers.Add(http.CanonicalHeaderKey(hp[0]), strings.TrimSpace(hp[1]))
+// moves the position of an error that is relative to a code block
+// to the position in the markdown file
+func shiftError(err error, line, col int) error {
+	var perr *ParseError
+	if errors.As(err, &perr) && perr.Line > 0 && line > 0 {
+		perr.Line += line - 1
+		perr.Column += col - 1
 	}
 
-	return rline, headers, body, nil
+	return err
+}
+
+func (r *withJSON) record() {
+	r.recorder = bytes.NewBuffer(nil)
+}
+
+func (r *withJSON) rewind() []byte {
+	b := r.recorder.Bytes()
+	r.recorder = nil
+	return b
+}
+
+func (p *withJSON) ParseHTTPMessage(r io.ReadCloser, fpath string) (string, http.Header, string, error) {
+	return ParseHTTPMessage(r, fpath)
 }
 
 //check method format
 func (p *withJSON) parseMethod(input string) (string, error) {
-	method := ""
-	for _, m := range ValidHTTPMethods {
-		if m == input {
-			method = m
-			break
-		}
-	}
-
-	if method == "" {
+	if !isMethod(input, p.methods) {
 		return "", fmt.Errorf("unexpected method %s", input)
 	}
 
-	return method, nil
+	return input, nil
 }
 
 func (p *withJSON) parsePath(input string) (string, error) {
@@ -135,93 +230,118 @@ func (p *withJSON) parsePath(input string) (string, error) {
 func (p *withJSON) parseWhen(r io.ReadCloser, fpath string) (*manifest.When, error) {
 	w := &manifest.When{}
 
-	rline, headers, body, err := p.ParseHTTPMessage(r, fpath)
+	m, err := readMessage(r, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = noDirectives(m, fpath)
 	if err != nil {
 		return nil, err
 	}
 
 	//request line should be 2 parts seperated by a space
-	rlinep := strings.SplitN(rline, " ", 2)
+	rlinep := strings.SplitN(m.Start, " ", 2)
 	if len(rlinep) != 2 {
-		return nil, UnexpectedRequestLineError(fpath, rline)
+		return nil, UnexpectedRequestLineError(fpath, m.StartLine, m.Start)
 	}
 
 	//get method
 	w.Method, err = p.parseMethod(rlinep[0])
 	if err != nil {
-		return nil, UnexpectedRequestLineMethodError(fpath, rlinep[0])
+		return nil, UnexpectedRequestLineMethodError(fpath, m.StartLine, rlinep[0], p.methods)
 	}
 
 	//check path
 	w.Path, err = p.parsePath(rlinep[1])
 	if err != nil {
-		return nil, UnexpectedRequestLinePathError(fpath, rlinep[1])
+		return nil, UnexpectedRequestLinePathError(fpath, m.StartLine, len(rlinep[0])+2, rlinep[1])
 	}
 
-	w.Headers = headers
-	w.Body = body
+	//query is stored apart from the path
+	w.Path, w.Query, err = splitQuery(w.Path)
+	if err != nil {
+		return nil, UnexpectedRequestLineQueryError(fpath, m.StartLine, len(rlinep[0])+strings.Index(rlinep[1], "?")+3, rlinep[1], err)
+	}
+
+	w.Headers = m.Headers
+	w.Body = m.Body
 
 	return w, nil
 }
 
-// parses a then file loosely based on the format of a standard http message
-func (p *withJSON) parseThen(r io.ReadCloser, fpath string) (*manifest.Then, error) {
-	t := &manifest.Then{}
-
+// parses a then block loosely based on the format of a standard http
+// message, the timeout of the case it sets is returned as well
+func (p *withJSON) parseThen(r io.ReadCloser, fpath string) (*manifest.Then, string, error) {
 	//parse as a standard http message
-	rline, headers, body, err := p.ParseHTTPMessage(r, fpath)
-	if err != nil {
-		return nil, err
-	}
-
-	//response line should be 2 parts seperated by a space
-	rlinep := strings.SplitN(rline, " ", 2)
-	if len(rlinep) != 2 {
-		return nil, UnexpectedResponseLineError(fpath, rline)
-	}
-
-	//first one should be parseable as int
-	code, err := strconv.Atoi(rlinep[0])
+	m, err := readMessage(r, fpath)
 	if err != nil {
-		return nil, UnexpectedResponseLineCodeError(fpath, rlinep[0], err)
+		return nil, "", err
 	}
 
-	t.StatusCode = code
-	t.Status = rlinep[1]
-	t.Headers = headers
-	t.Body = body
-	return t, nil
+	return newThen(m, fpath)
 }
 
 func (r *withJSON) ParseGiven(in []byte) (map[string]manifest.Given, []manifest.While, error) {
 	gs := make(map[string]manifest.Given)
 	ws := []manifest.While{}
 
+	//the lines of the paragraph follow each other in the source, locating
+	//each by itself would fail on lines that contained links
+	first, col := r.locate(string(in))
+	n := -1
+
 	s := bufio.NewScanner(bytes.NewBuffer(in))
 	for s.Scan() {
 		trimmed := strings.TrimSpace(s.Text())
+		if n >= 0 || trimmed != "" {
+			n++
+		}
 
 		//dont mind empty lines
 		if trimmed == "" {
 			continue
 		}
 
+		line := 0
+		if first > 0 {
+			line = first + n
+		}
+
 		if m := GivenDepExp.FindStringSubmatch(trimmed); m != nil {
-			if len(m) != 3 {
-				r.Errors <- fmt.Errorf("Unexpected dependency given line: %s", trimmed)
+
+			//'dependency' given, every quoted case is expected
+			id := strings.TrimSpace(m[1])
+			cnames, off := splitCaseNames(m[2])
+			if off >= 0 {
+				r.report(SeverityError, UnexpectedGivenLineError(r.fpath, line, col, trimmed))
+				continue
 			}
 
-			//'dependency' given
-			ws = append(ws, manifest.While{strings.TrimSpace(m[1]), strings.TrimSpace(m[2])})
+			for _, cname := range cnames {
+				var ok bool
+				ws, ok = addWhile(ws, manifest.While{ID: id, Case: cname})
+				if !ok {
+					r.report(SeverityWarning, DuplicateWhileWarning(r.fpath, line, col, id, cname))
+				}
+			}
 		} else if m := GivenStateExp.FindStringSubmatch(trimmed); m != nil {
-			if len(m) != 3 {
-				r.Errors <- fmt.Errorf("Unexpected state given line: %s", trimmed)
+
+			//'state' given, a provider can be in multiple states
+			pname := strings.TrimSpace(m[1])
+			snames, off := splitCaseNames(m[2])
+			if off >= 0 {
+				r.report(SeverityError, UnexpectedGivenLineError(r.fpath, line, col, trimmed))
+				continue
 			}
 
-			//'state' given
-			gs[strings.TrimSpace(m[1])] = manifest.Given{strings.TrimSpace(m[2])}
+			for _, sname := range snames {
+				if !addGiven(gs, pname, sname) {
+					r.report(SeverityWarning, DuplicateGivenWarning(r.fpath, line, col, pname, sname))
+				}
+			}
 		} else {
-			r.Errors <- fmt.Errorf("Unexpected line in given: %s", trimmed)
+			r.report(SeverityError, UnexpectedGivenLineError(r.fpath, line, col, trimmed))
 		}
 	}
 
@@ -229,76 +349,195 @@ func (r *withJSON) ParseGiven(in []byte) (map[string]manifest.Given, []manifest.
 }
 
 func (r *withJSON) ParseWhen(in []byte) (*manifest.When, error) {
-	return r.parseWhen(ioutil.NopCloser(bytes.NewBuffer(in)), "")
+	return r.parseWhen(ioutil.NopCloser(bytes.NewBuffer(in)), r.fpath)
 }
 
 func (r *withJSON) ParseThen(in []byte) (*manifest.Then, error) {
-	return r.parseThen(ioutil.NopCloser(bytes.NewBuffer(in)), "")
+	t, _, err := r.parseThen(ioutil.NopCloser(bytes.NewBuffer(in)), r.fpath)
+	return t, err
 }
 
-func (r *withJSON) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+// archetypes declared in a fenced block belong to the case or resource
+// the block is in, or to the whole manifest before the first resource
+func (r *withJSON) parseArchetypes(text []byte, line, col int) {
+	as, err := strategy.LoadArchetypes(bytes.NewReader(text))
+	if err != nil {
+		r.report(SeverityError, InvalidArchetypesError(r.fpath, line, col, err))
+		return
+	}
+
 	if r.openCase != nil {
+		r.openCase.Archetypes = append(r.openCase.Archetypes, as...)
+	} else if r.openResource != nil {
+		r.openResource.Archetypes = append(r.openResource.Archetypes, as...)
+	} else {
+		r.Manifest.Archetypes = append(r.Manifest.Archetypes, as...)
+	}
+}
 
-		//parse code block as when
-		if r.openCase.When.Path == "-" {
-			when, err := r.ParseWhen(text)
-			if err != nil {
-				r.Errors <- err
-			} else {
-				r.openCase.When = *when
-			}
+// the next code block holds the message of the statement
+func (r *withJSON) expect(stmt string, line, col int) {
+	r.closeStatement()
+	r.stated[stmt] = true
+	r.expecting, r.expectLine, r.expectCol = stmt, line, col
+}
 
-		}
+// ends the statement that is open, it is an error if the
+// code block with its message never came
+func (r *withJSON) closeStatement() {
+	if r.expecting != "" {
+		r.report(SeverityError, MissingStatementBlockError(r.fpath, r.expectLine, r.expectCol, r.expecting))
+	}
 
-		//parse code block as then
-		if r.openCase.Then.Status == "-" {
-			then, err := r.ParseThen(text)
-			if err != nil {
-				r.Errors <- err
-			} else {
-				r.openCase.Then = *then
-			}
+	r.expecting = ""
+	r.bodyFor = ""
+}
 
+// parses a code block as the message of the expected statement, the
+// block is consumed even if it fails to parse
+func (r *withJSON) parseStatement(text []byte, lang string, line, col int) {
+	stmt := r.expecting
+	r.expecting = ""
+	switch {
+	case lang == "" || lang == "http":
+	case lang == "http-response" && stmt == "then":
+	default:
+		r.report(SeverityError, UnexpectedBlockLangError(r.fpath, line, col, stmt, lang))
+		return
+	}
+
+	var err error
+	if stmt == "when" {
+		var when *manifest.When
+		if when, err = r.ParseWhen(text); err == nil {
+			r.openCase.When = *when
 		}
+	} else {
+		var then *manifest.Then
+		var timeout string
+		if then, timeout, err = r.parseThen(ioutil.NopCloser(bytes.NewBuffer(text)), r.fpath); err == nil {
+			r.openCase.Then = *then
+			r.openCase.Timeout = timeout
+		}
+	}
+
+	if err != nil {
+		r.report(SeverityError, shiftError(err, line, col))
+		return
+	}
+
+	r.bodyFor = stmt
+}
+
+// uses a tagged block as the body of the message that was just
+// parsed, the content type is inferred from the tag
+func (r *withJSON) parseBody(text []byte, lang string, line, col int) {
+	stmt := r.bodyFor
+	r.bodyFor = ""
+
+	body, headers := &r.openCase.When.Body, &r.openCase.When.Headers
+	if stmt == "then" {
+		body, headers = &r.openCase.Then.Body, &r.openCase.Then.Headers
+	}
+
+	if *body != "" {
+		r.report(SeverityError, DuplicateBodyError(r.fpath, line, col, stmt, lang))
+		return
+	}
+
+	*body = strings.TrimRight(string(text), "\n")
+	if *headers == nil {
+		*headers = http.Header{}
+	}
+
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", BlockContentTypes[lang])
+	}
+}
+
+func (r *withJSON) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+	line, col := r.locate(string(text))
+	_, isBody := BlockContentTypes[lang]
+	if lang == "archetypes" {
+		r.parseArchetypes(text, line, col)
+	} else if r.expecting != "" {
+		r.parseStatement(text, lang, line, col)
+	} else if r.bodyFor != "" && isBody {
+		r.parseBody(text, lang, line, col)
+	} else {
+		r.bodyFor = ""
 	}
 
 	r.Renderer.BlockCode(out, text, lang)
 }
 
+func (r *withJSON) DocumentHeader(out *bytes.Buffer) {
+	r.doc = out
+	r.Renderer.DocumentHeader(out)
+}
+
+// called when the whole page is rendered
+func (r *withJSON) DocumentFooter(out *bytes.Buffer) {
+	r.closeStatement()
+	r.flushProse()
+	r.Renderer.DocumentFooter(out)
+}
+
 func (r *withJSON) Paragraph(out *bytes.Buffer, text func() bool) {
 	r.record()
 	r.Renderer.Paragraph(out, text)
 	r.lastParagraph = r.rewind()
+	if out == r.doc {
+		r.prose = append(r.prose, string(r.lastParagraph))
+	}
 }
 
-// @todo write unit test for this
-// @todo check if can be done more elegant
-func (w *withJSON) AugmentGivenWithLinks(html []byte) []byte {
-	str := string(html)
+// the prose since the last heading describes the open case or, before
+// the first case, the open resource
+func (r *withJSON) flushProse() {
+	summary, desc, tags := splitProse(r.prose)
+	r.prose = nil
+	if r.openCase != nil {
+		r.openCase.Summary, r.openCase.Description, r.openCase.Tags = summary, desc, tags
+	} else if r.openResource != nil {
+		r.openResource.Summary, r.openResource.Description, r.openResource.Tags = summary, desc, tags
+	}
+}
+
+// a link to a dependency, or one of its cases, in a rendered page
+type depLink struct {
+	id    string
+	cname string
+}
 
-	//match a dependency given line that may include html
-	rp := regexp.MustCompile(`([\S]+)(\s+responds:\s+)('.*')`)
+// writes a link as placeholder that is replaced when the page is rendered
+// as site, see RenderSite
+func (w *withJSON) placeholder(id, cname string) string {
+	ph := fmt.Sprintf("dockpit-link-%s-%d", w.nonce, len(w.links))
+	w.links[ph] = depLink{id: id, cname: cname}
+	return ph
+}
 
-	//parse cases and turn them into links as well
-	caseL := []string{}
-	m := rp.FindStringSubmatch(str)
-	if len(m) < 3 {
-		//not a line suitable for augmeting, just return as is
-		return html
-	}
+// Turns the dependency and cases of every 'responds' line in rendered
+// html into links, they are resolved when the page is rendered as site
+func (w *withJSON) AugmentGivenWithLinks(html []byte) []byte {
+	return GivenDepLinkExp.ReplaceAllFunc(html, func(line []byte) []byte {
+		m := GivenDepLinkExp.FindSubmatch(line)
 
-	for _, part := range strings.Split(m[3], ",") {
-		cname := w.ToCaseName(strings.TrimSpace(part))
-		if cname != "" {
-			caseL = append(caseL, fmt.Sprintf(`<a href="{{ .Link "%s" "%s" }}">'%s'</a>`, m[1], cname, cname))
-		} else {
-			caseL = append(caseL, part)
+		//parse cases and turn them into links as well
+		caseL := []string{}
+		for _, part := range strings.Split(string(m[3]), ",") {
+			cname := w.ToCaseName(strings.TrimSpace(part))
+			if cname != "" {
+				caseL = append(caseL, fmt.Sprintf(`<a href="%s">'%s'</a>`, w.placeholder(string(m[1]), cname), cname))
+			} else {
+				caseL = append(caseL, part)
+			}
 		}
-	}
 
-	//and wrap it in a link
-	depL := rp.ReplaceAllString(str, `<a href="{{ .LinkDep "$1" }}">$1</a>$2 _CASELINKS_`)
-	return []byte(strings.Replace(depL, "_CASELINKS_", strings.Join(caseL, ", "), 1))
+		//and wrap the dependency in a link
+		return []byte(fmt.Sprintf(`<a href="%s">%s</a>%s%s`, w.placeholder(string(m[1]), ""), m[1], m[2], strings.Join(caseL, ", ")))
+	})
 }
 
 func (r *withJSON) BlockQuote(out *bytes.Buffer, text []byte) {
@@ -314,7 +553,7 @@ func (r *withJSON) BlockQuote(out *bytes.Buffer, text []byte) {
 			//get plain text given from last paragraph
 			c.Given, c.While, err = r.ParseGiven(r.lastParagraph)
 			if err != nil {
-				r.Errors <- err
+				r.report(SeverityError, err)
 			}
 
 			text = r.AugmentGivenWithLinks(text)
@@ -363,9 +602,14 @@ func insertBufferAt(out *bytes.Buffer, at int, in []byte) {
 
 func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id string) {
 
-	//we care about level 1,2 and 3
+	//we care about level 1,2 and 3, they also end the statement before
+	//and resources and cases the prose before
 	switch level {
-	case 1, 2, 3:
+	case 1, 2:
+		r.flushProse()
+		fallthrough
+	case 3:
+		r.closeStatement()
 		r.record()
 	}
 
@@ -374,16 +618,20 @@ func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id str
 	switch level {
 	case 1, 2, 3:
 		title := r.rewind()
+		line, col := r.locate(string(title))
 		switch level {
 
 		// H1
 		case 1:
 
-			//if we have an open resource, close it and append to manifest
+			//if we have an open resource, close it and append to manifest,
+			//the cases of a resource end with it
 			if r.openResource != nil {
 				r.openResource = nil
 			}
 
+			r.openCase = nil
+
 			// h1 is a resource, open a new one
 			pattern := r.ToResourcePatternPart(string(title))
 			if pattern != "" {
@@ -407,7 +655,7 @@ func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id str
 			cname := r.ToCaseName(string(title))
 			if cname != "" {
 				if r.openResource == nil {
-					r.Errors <- fmt.Errorf("Case outside resource")
+					r.report(SeverityError, CaseOutsideResourceHeaderError(r.fpath, line, col, cname))
 				} else {
 					r.openCase = &manifest.CaseData{
 						Name: cname,
@@ -415,7 +663,19 @@ func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id str
 						Then: manifest.Then{},
 					}
 
-					r.injectA(out, fmt.Sprintf(`&nbsp<a href="">test</a>`))
+					r.stated = map[string]bool{}
+
+					//the statements of a duplicate are still checked
+					if other, pattern := r.anchoredCase(cname); other == cname {
+						r.report(SeverityError, DuplicateCaseHeaderError(r.fpath, line, col, cname, pattern))
+						return
+					} else if other != "" {
+						r.report(SeverityError, DuplicateCaseAnchorError(r.fpath, line, col, cname, other, pattern))
+						return
+					}
+
+					//a stable anchor that other pages and services link to
+					r.injectA(out, fmt.Sprintf(`&nbsp;<a id="%s" class="case-anchor" href="#%s">#</a>`, CaseAnchor(cname), CaseAnchor(cname)))
 
 					r.openResource.Cases = append(r.openResource.Cases, r.openCase)
 				}
@@ -427,28 +687,28 @@ func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id str
 			//is when or then
 			if r.IsWhen(string(title)) {
 				if r.openCase == nil {
-					r.Errors <- fmt.Errorf("Encountered 'when' outside case")
+					r.report(SeverityError, StatementOutsideCaseError(r.fpath, line, col, "when"))
+					return
 				}
 
-				if r.openCase.When.Path != "" {
-					r.Errors <- fmt.Errorf("Encountered multiple 'when' statements in example")
+				if r.stated["when"] {
+					r.report(SeverityError, DuplicateStatementError(r.fpath, line, col, "when"))
 				}
 
-				//set a path that indicates to the code block
-				//parser that it should capture and store a when/then
-				r.openCase.When.Path = "-"
+				//the next code block is parsed as the request
+				r.expect("when", line, col)
 			} else if r.IsThen(string(title)) {
 				if r.openCase == nil {
-					r.Errors <- fmt.Errorf("Encountered 'then' outside case")
+					r.report(SeverityError, StatementOutsideCaseError(r.fpath, line, col, "then"))
+					return
 				}
 
-				if r.openCase.Then.Status != "" {
-					r.Errors <- fmt.Errorf("Encountered multiple 'then' statements in example")
+				if r.stated["then"] {
+					r.report(SeverityError, DuplicateStatementError(r.fpath, line, col, "then"))
 				}
 
-				//set a status that indicates to the code block
-				//parser that it should capture and store a when/then
-				r.openCase.Then.Status = "-"
+				//the next code block is parsed as the response
+				r.expect("then", line, col)
 			}
 
 		}
@@ -457,6 +717,46 @@ func (r *withJSON) Header(out *bytes.Buffer, text func() bool, level int, id str
 
 }
 
+// the name of a case, on this page or another one, with the same anchor
+// as the case name and the pattern of its resource
+func (r *withJSON) anchoredCase(cname string) (string, string) {
+	anchor := CaseAnchor(cname)
+	for _, res := range r.Manifest.Resources {
+		for _, c := range res.Cases {
+			if CaseAnchor(c.Name) == anchor {
+				return c.Name, res.Pattern
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// code, entities and autolinks are written as plain text of the paragraph
+func (r *withJSON) CodeSpan(out *bytes.Buffer, text []byte) {
+	if r.recorder != nil {
+		r.recorder.Write(text)
+	}
+
+	r.Renderer.CodeSpan(out, text)
+}
+
+func (r *withJSON) Entity(out *bytes.Buffer, entity []byte) {
+	if r.recorder != nil {
+		r.recorder.WriteString(html.UnescapeString(string(entity)))
+	}
+
+	r.Renderer.Entity(out, entity)
+}
+
+func (r *withJSON) AutoLink(out *bytes.Buffer, link []byte, kind int) {
+	if r.recorder != nil {
+		r.recorder.WriteString(strings.TrimPrefix(html.UnescapeString(string(link)), "mailto:"))
+	}
+
+	r.Renderer.AutoLink(out, link, kind)
+}
+
 func (r *withJSON) NormalText(out *bytes.Buffer, text []byte) {
 	if r.recorder != nil {
 		r.recorder.Write(text)
@@ -474,7 +774,15 @@ type Markdown struct {
 	Pages      map[string][]byte
 	CaseToPage map[string]string
 
-	data *manifest.ManifestData
+	methods []string
+	data    *manifest.ManifestData
+	diags   Diagnostics
+
+	//the page that set each front matter value
+	origins map[string]string
+
+	//links of the pages by their placeholder
+	links map[string]depLink
 }
 
 func NewMarkdown(dir string) *Markdown {
@@ -482,6 +790,7 @@ func NewMarkdown(dir string) *Markdown {
 		Dir:        dir,
 		Pages:      make(map[string][]byte),
 		CaseToPage: make(map[string]string),
+		links:      make(map[string]depLink),
 	}
 
 	p.reset()
@@ -501,15 +810,25 @@ func (p *Markdown) visit(fpath string, fi os.FileInfo, err error) error {
 		return err
 	}
 
-	//create rendere nad handle errors
-	renderer := renderer(p.data)
-	go func() {
-		for err := range renderer.Errors {
-			fmt.Println("ERROR", err)
+	if !fi.IsDir() {
+
+		//archetypes in the root of the pages are for the whole manifest
+		if rel == "archetypes.json" {
+			f, err := os.Open(fpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			as, err := strategy.LoadArchetypes(f)
+			if err != nil {
+				p.diags = append(p.diags, NewDiagnostic(SeverityError, fpath, InvalidArchetypesError(fpath, 0, 0, err)))
+				return nil
+			}
+
+			p.data.Archetypes = append(p.data.Archetypes, as...)
 		}
-	}()
 
-	if !fi.IsDir() {
 		if filepath.Ext(fpath) == ".md" {
 
 			md, err := ioutil.ReadFile(fpath)
@@ -517,17 +836,31 @@ func (p *Markdown) visit(fpath string, fi os.FileInfo, err error) error {
 				return err
 			}
 
-			//store html for page
-			p.Pages[rel] = blackfriday.Markdown(md, renderer, 0)
+			//front matter describes the manifest as a whole
+			fm, n, err := parseFrontMatter(md, fpath)
+			if err != nil {
+				p.diags = append(p.diags, NewDiagnostic(SeverityError, fpath, err))
+			} else if fm != nil {
+				p.diags = append(p.diags, fm.merge(p.data, p.origins, fpath)...)
+			}
+
+			//store html for page, problems are collected by the
+			//renderer and located after the front matter
+			renderer := renderer(p.data, fpath, md, p.methods)
+			renderer.offset = n
+			p.Pages[rel] = blackfriday.Markdown(md[n:], renderer, blackfriday.EXTENSION_FENCED_CODE)
+			p.diags = append(p.diags, renderer.Diags...)
+			for ph, l := range renderer.links {
+				p.links[ph] = l
+			}
 
-			//map parsed data to markdown files
+			//map parsed data to markdown files, case
+			//names are unique across pages
 			for _, res := range p.data.Resources {
 				for _, c := range res.Cases {
-					if _, ok := p.CaseToPage[c.Name]; ok {
-						continue
+					if _, ok := p.CaseToPage[c.Name]; !ok {
+						p.CaseToPage[c.Name] = rel
 					}
-
-					p.CaseToPage[c.Name] = rel
 				}
 			}
 
@@ -537,19 +870,43 @@ func (p *Markdown) visit(fpath string, fi os.FileInfo, err error) error {
 	return nil
 }
 
+// Allows extension methods (e.g PROPFIND) in addition to the standard
+// http methods to be used in 'when' code blocks
+func (p *Markdown) RegisterMethods(methods ...string) error {
+	if err := validateMethods(methods); err != nil {
+		return err
+	}
+
+	p.methods = append(p.methods, methods...)
+	return nil
+}
+
 func (p *Markdown) reset() {
 	p.data = &manifest.ManifestData{}
+	p.diags = Diagnostics{}
+	p.origins = map[string]string{}
 }
 
-func (p *Markdown) Parse() (*manifest.ManifestData, error) {
+// Parses all markdown files and returns the (partial) manifest data
+// with every problem encountered along the way
+func (p *Markdown) ParseAll() (*manifest.ManifestData, Diagnostics) {
 	defer p.reset()
 
-	//walk nodes
+	//walk nodes, a walk error is a problem with the directory itself
 	err := filepath.Walk(p.Dir, p.visit)
 	if err != nil {
+		p.diags = append(p.diags, NewDiagnostic(SeverityError, p.Dir, err))
+	}
+
+	return p.data, p.diags
+}
+
+func (p *Markdown) Parse() (*manifest.ManifestData, error) {
+	data, diags := p.ParseAll()
+	if err := diags.Err(); err != nil {
 		return nil, err
 	}
 
 	//return result
-	return p.data, nil
+	return data, nil
 }
@@ -1,7 +1,10 @@
 package parser_test
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,13 +24,15 @@ func TestParse(t *testing.T) {
 	assert.Len(t, md.Resources, 2)
 	assert.Len(t, md.Resources[0].Cases, 2)
 	assert.Len(t, md.Resources[0].Cases[0].Given, 2)
-	assert.Len(t, md.Resources[0].Cases[0].While, 1)
+	assert.Len(t, md.Resources[0].Cases[0].While, 2)
 
 	//assert given content
 	assert.Equal(t, "a single user", md.Resources[0].Cases[0].Given["mongo"].Name)
 	assert.Equal(t, "no cached users", md.Resources[0].Cases[0].Given["redis"].Name)
 	assert.Equal(t, "authorized", md.Resources[0].Cases[0].While[0].Case)
 	assert.Equal(t, "pit-token", md.Resources[0].Cases[0].While[0].ID)
+	assert.Equal(t, "unauthorized", md.Resources[0].Cases[0].While[1].Case)
+	assert.Equal(t, "not authorized", md.Resources[0].Cases[1].While[1].Case)
 
 	//assert when parsing
 	assert.Equal(t, "/users/31", md.Resources[0].Cases[0].When.Path)
@@ -41,3 +46,332 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, `{"id": "21", "username": "coolgirl21"}`, md.Resources[0].Cases[0].Then.Body)
 
 }
+
+func TestParseMarkdownDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockpit_markdown_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	md := "## 'orphan'\n\n# /notes\n\n## 'list notes'\n\n### when:\n\n\tGET notes\n\n### then:\n\n\t200 OK\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "notes.md"), []byte(md), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := parser.NewMarkdown(dir)
+	data, diags := p.ParseAll()
+
+	//parsing continues after the errors
+	assert.Len(t, data.Resources, 1)
+	assert.Len(t, data.Resources[0].Cases, 1)
+	assert.Equal(t, 200, data.Resources[0].Cases[0].Then.StatusCode)
+
+	if assert.Len(t, diags, 2) {
+		assert.Equal(t, parser.ErrCaseOutsideResource, diags[0].Code)
+		assert.Equal(t, 1, diags[0].Line)
+
+		//position is relative to the markdown file, not the code block
+		assert.Equal(t, parser.ErrRequestLinePath, diags[1].Code)
+		assert.Equal(t, filepath.Join(dir, "notes.md"), diags[1].File)
+		assert.Equal(t, 9, diags[1].Line)
+		assert.Equal(t, 6, diags[1].Column)
+	}
+
+	//strict parsing returns the first error
+	_, err = p.Parse()
+	assert.Equal(t, diags[0].Error(), err.Error())
+}
+
+func TestParseMarkdownDirectives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockpit_markdown_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	md := "# /notes\n\n## 'list notes'\n\n### when:\n\n\tGET /notes\n\n### then:\n\n\t200 OK\n\t@ignore: $[*].created_at\n\t@expect: $ length 2\n\t@headers: strict\n\t@ignore-header: date\n\t@timeout: 2s\n\t@bogus: x\n\n\t[]\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "notes.md"), []byte(md), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, diags := parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrDirective, diags[0].Code)
+		assert.Equal(t, 17, diags[0].Line)
+	}
+
+	md = strings.Replace(md, "\t@bogus: x\n", "", 1)
+	err = ioutil.WriteFile(filepath.Join(dir, "notes.md"), []byte(md), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := parser.NewMarkdown(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	then := data.Resources[0].Cases[0].Then
+	assert.Equal(t, []string{"$[*].created_at"}, then.Ignore)
+	assert.Equal(t, []string{"$ length 2"}, then.Expect)
+	assert.Equal(t, "strict", then.HeaderMode)
+	assert.Equal(t, []string{"Date"}, then.IgnoreHeaders)
+	assert.Equal(t, "2s", data.Resources[0].Cases[0].Timeout)
+	assert.Equal(t, "[]", then.Body)
+}
+
+func TestParseMarkdownArchetypes(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"archetypes.json":       `[{"value": "root"}]`,
+		"notes/archetypes.json": `[{"value": "nested"}]`,
+		"notes.md": "```archetypes\n[{\"value\": \"page\"}, {\"value\": \"other\"}]\n```\n\n# /notes\n\n## 'list notes'\n\n" +
+			"```archetypes\n[{\"value\": \"case\"}]\n```\n\n### when:\n\n\tGET /notes\n\n### then:\n\n\t200 OK\n",
+		"users.md": "# /users\n\n```archetypes\n{bogus\n```\n",
+	})
+	defer os.RemoveAll(dir)
+
+	data, diags := parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrArchetypes, diags[0].Code)
+		assert.Equal(t, filepath.Join(dir, "users.md"), diags[0].File)
+		assert.Equal(t, 4, diags[0].Line)
+	}
+
+	//blocks are scoped to where they are declared
+	c := data.Resources[0].Cases[0]
+	assert.Len(t, data.Archetypes, 3)
+	assert.Len(t, data.Resources[0].Archetypes, 0)
+	assert.Len(t, c.Archetypes, 1)
+
+	assert.Equal(t, "/notes", c.When.Path)
+	assert.Equal(t, 200, c.Then.StatusCode)
+
+	dir = writeTree(t, map[string]string{
+		"archetypes.json": `{bogus`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags = parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrArchetypes, diags[0].Code)
+		assert.Equal(t, filepath.Join(dir, "archetypes.json"), diags[0].File)
+	}
+}
+
+func TestParseMarkdownMultipleCases(t *testing.T) {
+	_, diags := parser.NewMarkdown(".example_markdown").ParseAll()
+
+	//the example expects 'authorized' twice
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.WarnDuplicateWhile, diags[0].Code)
+		assert.Equal(t, parser.SeverityWarning, diags[0].Severity)
+		assert.Equal(t, 8, diags[0].Line)
+	}
+
+	dir := writeTree(t, map[string]string{
+		"notes.md": "# /notes\n\n## 'list notes'\n\n> mysql has: 'users', 'notes'\n> pit-token responds: 'authorized', expired\n\n### when:\n\n\tGET /notes\n",
+	})
+	defer os.RemoveAll(dir)
+
+	data, diags := parser.NewMarkdown(dir).ParseAll()
+	assert.Equal(t, []string{"users", "notes"}, data.Resources[0].Cases[0].Given["mysql"].States())
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrGivenLine, diags[0].Code)
+		assert.Equal(t, 6, diags[0].Line)
+	}
+}
+
+func TestParseMarkdownDuplicateCases(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"notes.md": "# /notes\n\n## 'not found'\n\n### when:\n\n\tGET /notes/1\n\n### then:\n\n\t404 Not Found\n",
+		"users.md": "# /users\n\n## 'not found'\n\n### when:\n\n\tGET users\n",
+	})
+	defer os.RemoveAll(dir)
+
+	p := parser.NewMarkdown(dir)
+	data, diags := p.ParseAll()
+
+	//the duplicate is left out, its statements are still checked
+	if assert.Len(t, diags, 2) {
+		assert.Equal(t, parser.ErrDuplicateCase, diags[0].Code)
+		assert.Equal(t, filepath.Join(dir, "users.md"), diags[0].File)
+		assert.Equal(t, 3, diags[0].Line)
+		assert.Contains(t, diags[0].Error(), "/notes")
+		assert.Equal(t, parser.ErrRequestLinePath, diags[1].Code)
+	}
+
+	assert.Len(t, data.Resources[1].Cases, 0)
+	assert.Equal(t, map[string]string{"not found": "notes.md"}, p.CaseToPage)
+	assert.NotContains(t, string(p.Pages["users.md"]), "case-anchor")
+
+	//different names may not share an anchor either
+	dir = writeTree(t, map[string]string{
+		"notes.md": "# /notes\n\n## 'List notes'\n\n## 'list  notes!'\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags = parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrDuplicateAnchor, diags[0].Code)
+		assert.Equal(t, 5, diags[0].Line)
+		assert.Contains(t, diags[0].Error(), "case-list-notes")
+	}
+}
+
+func TestParseMarkdownFencedBlocks(t *testing.T) {
+	md := "# /notes\n\n" +
+		"## 'create note'\n\n### when:\n\n```http\nPOST /notes\n```\n\n```json\n{\"text\": \"hi\"}\n```\n\n" +
+		"### then:\n\n```http-response\n201 Created\nContent-Type: application/vnd.note+json\n```\n\n```json\n{\"id\": 1}\n```\n\n" +
+		"## 'list notes'\n\n### when:\n\n```http-response\n200 OK\n```\n\n### then:\n\nnothing here\n\n" +
+		"## 'remove note'\n\n### when:\n\n\tDELETE /notes/1\n\n### then:\n"
+
+	dir := writeTree(t, map[string]string{"notes.md": md})
+	defer os.RemoveAll(dir)
+
+	data, diags := parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 3) {
+		assert.Equal(t, parser.ErrBlockLang, diags[0].Code)
+		assert.Equal(t, 31, diags[0].Line)
+		assert.Equal(t, parser.ErrMissingBlock, diags[1].Code)
+		assert.Equal(t, 34, diags[1].Line)
+		assert.Equal(t, parser.ErrMissingBlock, diags[2].Code)
+		assert.Equal(t, 44, diags[2].Line)
+	}
+
+	//bodies of tagged blocks get a content type, unless the message has one
+	c := data.Resources[0].Cases[0]
+	assert.Equal(t, "/notes", c.When.Path)
+	assert.Equal(t, `{"text": "hi"}`, c.When.Body)
+	assert.Equal(t, "application/json", c.When.Headers.Get("Content-Type"))
+	assert.Equal(t, 201, c.Then.StatusCode)
+	assert.Equal(t, `{"id": 1}`, c.Then.Body)
+	assert.Equal(t, "application/vnd.note+json", c.Then.Headers.Get("Content-Type"))
+
+	//nothing of a statement without message is left in the manifest
+	c = data.Resources[0].Cases[1]
+	assert.Equal(t, "", c.When.Path)
+	assert.Equal(t, "", c.Then.Status)
+
+	c = data.Resources[0].Cases[2]
+	assert.Equal(t, "DELETE", c.When.Method)
+	assert.Equal(t, "", c.Then.Status)
+}
+
+func TestParseMarkdownFrontMatter(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"notes.md": "---\nname: notes\nversion: \"1.2\"\nowners:\n  - alice\n  - bob\nbase_path: /api\nheaders:\n  Accept: application/json\n---\n" +
+			"# /notes\n\n## 'list notes'\n\n### when:\n\n\tGET /notes\n\n### then:\n\n\t200 OK\n",
+		"users.md": "+++\nname = \"notes\"\nowners = [\"alice\", \"bob\"]\n\n[headers]\nX-Client = \"docs\"\n+++\n# /users\n",
+	})
+	defer os.RemoveAll(dir)
+
+	data, err := parser.NewMarkdown(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "notes", data.Name)
+	assert.Equal(t, "1.2", data.Version)
+	assert.Equal(t, []string{"alice", "bob"}, data.Owners)
+	assert.Equal(t, "/api", data.BasePath)
+	assert.Equal(t, "application/json", data.Headers.Get("Accept"))
+	assert.Equal(t, "docs", data.Headers.Get("X-Client"))
+
+	//the front matter is not part of the page
+	assert.Len(t, data.Resources, 2)
+	assert.Equal(t, "/notes", data.Resources[0].Cases[0].When.Path)
+
+	//pages can't disagree
+	dir = writeTree(t, map[string]string{
+		"notes.md": "---\nname: notes\nheaders:\n  Accept: application/json\n---\n",
+		"users.md": "---\nname: users\nheaders:\n  accept: text/plain\nowner: bob\n---\n",
+		"zoo.md":   "---\nname: notes\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags := parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 4) {
+		assert.Equal(t, parser.ErrFrontMatterConflict, diags[0].Code)
+		assert.Equal(t, 2, diags[0].Line)
+		assert.Contains(t, diags[0].Error(), filepath.Join(dir, "notes.md"))
+		assert.Equal(t, parser.ErrFrontMatterConflict, diags[1].Code)
+		assert.Equal(t, "headers.Accept", diags[1].Snippet)
+		assert.Equal(t, parser.WarnUnknownFrontMatter, diags[2].Code)
+		assert.Equal(t, parser.SeverityWarning, diags[2].Severity)
+		assert.Equal(t, 5, diags[2].Line)
+		assert.Equal(t, parser.ErrFrontMatter, diags[3].Code)
+		assert.Equal(t, filepath.Join(dir, "zoo.md"), diags[3].File)
+	}
+
+	//keys of site generators are ignored, lines may end with '\r\n'
+	dir = writeTree(t, map[string]string{
+		"notes.md": "---\r\ntitle: Notes\r\nname: notes\r\n---\r\n# /notes\r\n",
+	})
+	defer os.RemoveAll(dir)
+
+	data, diags = parser.NewMarkdown(dir).ParseAll()
+	assert.NoError(t, diags.Err())
+	assert.Equal(t, "notes", data.Name)
+	assert.Len(t, data.Resources, 1)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.WarnUnknownFrontMatter, diags[0].Code)
+		assert.Equal(t, 2, diags[0].Line)
+	}
+
+	//lines the scanner can't read are not mistaken for a missing end
+	dir = writeTree(t, map[string]string{
+		"notes.md": "---\nname: " + strings.Repeat("n", 70000) + "\n---\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags = parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrFrontMatter, diags[0].Code)
+		assert.Contains(t, diags[0].Error(), "failed to read front matter")
+	}
+
+	//problems in the page are not located in the front matter
+	dir = writeTree(t, map[string]string{
+		"notes.md": "---\n# 'orphan' is a case without a resource\nname: notes\n---\n## 'orphan'\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, diags = parser.NewMarkdown(dir).ParseAll()
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, parser.ErrCaseOutsideResource, diags[0].Code)
+		assert.Equal(t, 5, diags[0].Line)
+	}
+}
+
+func TestParseMarkdownProse(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"notes.md": "Notes service.\n\n# /notes\n\nNotes of *users*.\n\ntags: notes, storage\n\n" +
+			"## 'list notes'\n\nLists all notes.\n\n> mysql has: 'notes'\n\n### when:\n\n\tGET /notes\n\n" +
+			"Newest first, see [sorting](http://example.com).\n\n### then:\n\n\t200 OK\n\n" +
+			"Use `id` &amp; <http://a.b>.\n\n" +
+			"# /users\n\nUsers.\n",
+	})
+	defer os.RemoveAll(dir)
+
+	data, err := parser.NewMarkdown(dir).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := data.Resources[0]
+	assert.Equal(t, "Notes of users.", res.Summary)
+	assert.Equal(t, "", res.Description)
+	assert.Equal(t, []string{"notes", "storage"}, res.Tags)
+
+	//quoted givens are not prose
+	c := res.Cases[0]
+	assert.Equal(t, "Lists all notes.", c.Summary)
+	assert.Equal(t, "Newest first, see sorting.\n\nUse id & http://a.b.", c.Description)
+	assert.Equal(t, "notes", c.Given["mysql"].Name)
+
+	//a resource ends the case before
+	assert.Equal(t, "Users.", data.Resources[1].Summary)
+}
@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dockpit/lang/manifest"
+)
+
+// a http message as read from a when/then file or code block, line
+// numbers are kept to position errors
+type message struct {
+	Start      string
+	StartLine  int
+	Headers    http.Header
+	Directives []*directive
+	Body       string
+	BodyLine   int
+}
+
+// a line in the header section that starts with '@', e.g: '@ignore: $.created_at'
+type directive struct {
+	Name  string
+	Value string
+	Text  string
+	Line  int
+}
+
+// Parses a http message loosely based on the http spec: a start line, header
+// lines and an optional body seperated from the headers by an empty line. The
+// body is returned byte-for-byte, only the line ending that terminates the
+// message itself is dropped; a body that should end with a newline is written
+// with an additional empty line. Lines are not limited in length. Directive
+// lines (starting with '@') in the header section are not returned.
+func ParseHTTPMessage(r io.Reader, fpath string) (string, http.Header, string, error) {
+	m, err := readMessage(r, fpath)
+	return m.Start, m.Headers, m.Body, err
+}
+
+func readMessage(r io.Reader, fpath string) (*message, error) {
+	m := &message{Headers: make(http.Header)}
+	hlines := []string{}
+	hnums := []int{}
+
+	n := 0
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return m, err
+		}
+
+		n++
+		text := strings.TrimRight(line, "\r\n")
+		if text == "" {
+
+			//empty lines before the start line are ignored, after
+			//the start line it indicates the start of the body
+			if m.Start != "" {
+				b, err := ioutil.ReadAll(br)
+				if err != nil {
+					return m, err
+				}
+
+				m.Body = trimMessageEnd(string(b))
+				m.BodyLine = n + 1
+				break
+			}
+		} else if m.Start == "" {
+
+			//first line should be the request or response line
+			m.Start = text
+			m.StartLine = n
+		} else {
+
+			//add as headers
+			hlines = append(hlines, text)
+			hnums = append(hnums, n)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	//check/parse header format
+	for i, h := range hlines {
+		hp := strings.SplitN(h, ":", 2)
+		if len(hp) != 2 {
+			return m, UnexpectedHeaderLineError(fpath, hnums[i], h)
+		}
+
+		if strings.HasPrefix(h, "@") {
+			m.Directives = append(m.Directives, &directive{hp[0][1:], strings.TrimSpace(hp[1]), h, hnums[i]})
+			continue
+		}
+
+		m.Headers.Add(http.CanonicalHeaderKey(hp[0]), strings.TrimSpace(hp[1]))
+	}
+
+	return m, nil
+}
+
+// directives are only understood in 'then' messages
+func noDirectives(m *message, fpath string) error {
+	if len(m.Directives) == 0 {
+		return nil
+	}
+
+	d := m.Directives[0]
+	return UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("directives are only allowed in 'then'"))
+}
+
+// creates a 'then' from a response message, both parsers share it. The
+// timeout of the case, if the message sets one, is returned as well
+func newThen(m *message, fpath string) (*manifest.Then, string, error) {
+	t := &manifest.Then{}
+
+	//response line should be 2 parts seperated by a space
+	rlinep := strings.SplitN(m.Start, " ", 2)
+	if len(rlinep) != 2 {
+		return nil, "", UnexpectedResponseLineError(fpath, m.StartLine, m.Start)
+	}
+
+	//first one should be a status code, a range or alternatives
+	codes, err := manifest.ParseStatusRanges(rlinep[0])
+	if err != nil {
+		return nil, "", UnexpectedResponseLineCodeError(fpath, m.StartLine, rlinep[0], err)
+	}
+
+	//only ranges and alternatives are kept in structured form
+	if len(codes) > 1 || codes[0].Min != codes[0].Max {
+		t.StatusCodes = codes
+	}
+
+	//assertions about the response beyond the example
+	timeout, err := applyThenDirectives(t, m, fpath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	t.StatusCode = codes[0].Code()
+	t.Status = rlinep[1]
+	t.Headers = m.Headers
+	t.Body = m.Body
+	return t, timeout, nil
+}
+
+// applies the directives of a 'then' message: '@expect: <path> <check>'
+// adds a field expectation, '@ignore: <path>' ignores a field, '@headers:
+// strict' sets the header mode and '@ignore-header: <name>' ignores a header.
+// The duration of '@timeout: <duration>' is returned for the case
+func applyThenDirectives(t *manifest.Then, m *message, fpath string) (string, error) {
+	timeout := ""
+	for _, d := range m.Directives {
+		switch d.Name {
+		case "expect":
+			if _, err := manifest.ParseExpectation(d.Value); err != nil {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, err)
+			}
+
+			t.Expect = append(t.Expect, d.Value)
+		case "ignore":
+			if _, err := manifest.ParseJSONPath(d.Value); err != nil {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, err)
+			}
+
+			t.Ignore = append(t.Ignore, d.Value)
+		case "headers":
+			switch manifest.HeaderMode(d.Value) {
+			case manifest.HeadersAtLeast, manifest.HeadersStrict:
+			default:
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("expected header mode '%s' or '%s'", manifest.HeadersAtLeast, manifest.HeadersStrict))
+			}
+
+			if t.HeaderMode != "" && t.HeaderMode != d.Value {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("header mode is already set to '%s'", t.HeaderMode))
+			}
+
+			t.HeaderMode = d.Value
+		case "ignore-header":
+			if d.Value == "" || strings.ContainsAny(d.Value, " \t:") {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("expected a single header name"))
+			}
+
+			t.IgnoreHeaders = append(t.IgnoreHeaders, http.CanonicalHeaderKey(d.Value))
+		case "timeout":
+			if timeout != "" {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("timeout is already set to '%s'", timeout))
+			}
+
+			dur, err := time.ParseDuration(d.Value)
+			if err != nil || dur <= 0 {
+				return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("expected a positive duration, e.g '500ms' or '2s'"))
+			}
+
+			timeout = d.Value
+		default:
+			return "", UnexpectedDirectiveError(fpath, d.Line, d.Text, fmt.Errorf("expected '@expect:', '@ignore:', '@headers:', '@ignore-header:' or '@timeout:'"))
+		}
+	}
+
+	return timeout, nil
+}
+
+// removes the line ending that terminates the message
+func trimMessageEnd(body string) string {
+	if strings.HasSuffix(body, "\r\n") {
+		return body[:len(body)-2]
+	}
+
+	return strings.TrimSuffix(body, "\n")
+}
@@ -0,0 +1,53 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dockpit/lang/parser"
+)
+
+func TestParseHTTPMessageBody(t *testing.T) {
+	msg := "200 OK\nContent-Type: application/xml\n\n<notes>\n  <note/>\n</notes>\n"
+
+	rline, headers, body, err := parser.ParseHTTPMessage(strings.NewReader(msg), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//newlines inside the body should be kept
+	assert.Equal(t, "200 OK", rline)
+	assert.Equal(t, "application/xml", headers.Get("Content-Type"))
+	assert.Equal(t, "<notes>\n  <note/>\n</notes>", body)
+
+	//crlf and a trailing newline (an additional empty line) are kept as well
+	_, headers, body, err = parser.ParseHTTPMessage(strings.NewReader("200 OK\r\nX-A: b\r\n\r\n{}\r\n{}\r\n\r\n"), "then")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "b", headers.Get("X-A"))
+	assert.Equal(t, "{}\r\n{}\r\n", body)
+
+	//no body at all
+	_, _, body, err = parser.ParseHTTPMessage(strings.NewReader("GET /notes"), "when")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "", body)
+}
+
+func TestParseHTTPMessageLongLines(t *testing.T) {
+	long := strings.Repeat("a", 256*1024)
+
+	_, headers, body, err := parser.ParseHTTPMessage(strings.NewReader("POST /notes\nX-Long: "+long+"\n\n"+long+"\n"), "when")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, long, headers.Get("X-Long"))
+	assert.Equal(t, long, body)
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// a paragraph that lists tags instead of describing, e.g: 'tags: auth, users'
+var TagsExp = regexp.MustCompile(`(?i)^tags:\s*(.*)$`)
+
+// blank lines separate paragraphs
+var paragraphExp = regexp.MustCompile(`\n\s*\n`)
+
+// Splits prose about a resource or case into its parts: the first paragraph
+// is the summary and the ones after it the description. A paragraph that
+// starts with 'tags:' lists comma separated tags
+func splitProse(paragraphs []string) (summary, description string, tags []string) {
+	desc := []string{}
+	for _, par := range paragraphs {
+		par = strings.TrimSpace(par)
+		if par == "" {
+			continue
+		}
+
+		if m := TagsExp.FindStringSubmatch(par); m != nil {
+			for _, tag := range strings.Split(m[1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+
+			continue
+		}
+
+		if summary == "" {
+			summary = par
+		} else {
+			desc = append(desc, par)
+		}
+	}
+
+	return summary, strings.Join(desc, "\n\n"), tags
+}
+
+// splits the text of a README into paragraphs, markdown
+// headings (e.g the title) are not part of the prose
+func readmeParagraphs(text string) []string {
+	pars := []string{}
+	for _, par := range paragraphExp.Split(strings.Replace(text, "\r\n", "\n", -1), -1) {
+		lines := []string{}
+		for _, l := range strings.Split(par, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(l), "#") {
+				lines = append(lines, l)
+			}
+		}
+
+		pars = append(pars, strings.Join(lines, "\n"))
+	}
+
+	return pars
+}
+
+// Returns wether the file is a README with prose about
+// the resource or case directory it is in
+func isReadme(name string) bool {
+	return strings.EqualFold(strings.TrimSuffix(name, ".md"), "readme")
+}
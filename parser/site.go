@@ -0,0 +1,230 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The file of a site that lists the page of every case with its anchor
+// by the case name, e.g: {"list notes": "notes.html#case-list-notes"}
+const SiteCasesFile = "cases.json"
+
+// a link in a parsed page that is resolved when it is rendered as site
+var linkPlaceholderExp = regexp.MustCompile(`dockpit-link-[0-9a-f]{16}-[0-9]+`)
+
+// the document every rendered page is wrapped in
+var siteLayout = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+</head>
+<body>
+%s
+</body>
+</html>
+`
+
+// Returns the id of the anchor of a case on its page, it only depends on
+// the case name so links to it stay the same across builds
+func CaseAnchor(cname string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+
+		return '-'
+	}, cname)
+
+	parts := strings.FieldsFunc(slug, func(r rune) bool { return r == '-' })
+	return "case-" + strings.Join(parts, "-")
+}
+
+// Options for rendering the pages into a static site
+type SiteOptions struct {
+
+	//the service the site documents, shown in the page titles
+	Title string
+
+	//documentation of dependencies by their id, relative urls are relative
+	//to the root of the site
+	Docs map[string]string
+
+	//the cases of dependencies by their id, as listed in the SiteCasesFile
+	//of their site. A case is linked to its section, if it isn't listed
+	//to the case anchor in the index of the documentation
+	DocCases map[string]map[string]string
+}
+
+// the html file a markdown page is rendered to
+func pageFile(rel string) string {
+	return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)) + ".html")
+}
+
+// the documentation of a dependency as seen from a file of the site
+func (opts SiteOptions) doc(file, id string) (string, bool) {
+	doc, ok := opts.Docs[id]
+	if !ok {
+		return "", false
+	}
+
+	u, err := url.Parse(doc)
+	if err != nil || u.Scheme != "" || u.Host != "" || path.IsAbs(u.Path) {
+		return doc, true
+	}
+
+	return strings.Repeat("../", strings.Count(file, "/")) + doc, true
+}
+
+// Links to the documentation of a dependency, the link is written into
+// an attribute and is escaped as such
+func (opts SiteOptions) linkDep(file, id string) string {
+	if doc, ok := opts.doc(file, id); ok {
+		return html.EscapeString(doc)
+	}
+
+	return "#"
+}
+
+// Links to a case of a dependency, it is never a case of this service so
+// without documentation of the dependency there is nothing to link to
+func (opts SiteOptions) link(file, id, cname string) string {
+	doc, ok := opts.doc(file, id)
+	if !ok {
+		return "#"
+	}
+
+	if page, ok := opts.DocCases[id][cname]; ok {
+		if !strings.HasSuffix(doc, "/") {
+			doc += "/"
+		}
+
+		return html.EscapeString(doc + page)
+	}
+
+	return html.EscapeString(doc) + "#" + CaseAnchor(cname)
+}
+
+// lists every case with a link to its page, the items have the case
+// anchors unless the case is on the index page itself
+func (p *Markdown) caseIndex() string {
+	cnames := []string{}
+	for cname := range p.CaseToPage {
+		cnames = append(cnames, cname)
+	}
+
+	sort.Slice(cnames, func(i, k int) bool {
+		pi, pk := p.CaseToPage[cnames[i]], p.CaseToPage[cnames[k]]
+		if pi != pk {
+			return pi < pk
+		}
+
+		return cnames[i] < cnames[k]
+	})
+
+	buf := bytes.NewBufferString("<ul class=\"cases\">\n")
+	for _, cname := range cnames {
+		file := pageFile(p.CaseToPage[cname])
+		anchor := CaseAnchor(cname)
+		id := ""
+		if file != "index.html" {
+			id = fmt.Sprintf(` id="%s"`, anchor)
+		}
+
+		fmt.Fprintf(buf, "<li%s><a href=\"%s#%s\">%s</a> (%s)</li>\n", id, html.EscapeString(file), anchor, html.EscapeString(cname), html.EscapeString(file))
+	}
+
+	buf.WriteString("</ul>\n")
+	return buf.String()
+}
+
+// Renders the parsed pages into html files by their path in the site. Links
+// in the pages are resolved and an index.html lists every case, if there is
+// an index page the list is added to it. The SiteCasesFile is added as well
+func (p *Markdown) RenderSite(opts SiteOptions) (map[string][]byte, error) {
+	rels := []string{}
+	for rel := range p.Pages {
+		rels = append(rels, rel)
+	}
+
+	sort.Strings(rels)
+	bodies := map[string]string{}
+	for _, rel := range rels {
+		file := pageFile(rel)
+
+		//only placeholders of the parser are replaced, the content of the
+		//page is never interpreted
+		bodies[file] = string(linkPlaceholderExp.ReplaceAllFunc(p.Pages[rel], func(ph []byte) []byte {
+			l, ok := p.links[string(ph)]
+			if !ok {
+				return ph
+			}
+
+			if l.cname == "" {
+				return []byte(opts.linkDep(file, l.id))
+			}
+
+			return []byte(opts.link(file, l.id, l.cname))
+		}))
+	}
+
+	bodies["index.html"] += p.caseIndex()
+
+	site := map[string][]byte{}
+	for file, body := range bodies {
+		title := strings.TrimSuffix(file, ".html")
+		if opts.Title != "" {
+			title = opts.Title + ": " + title
+		}
+
+		site[file] = []byte(fmt.Sprintf(siteLayout, html.EscapeString(title), body))
+	}
+
+	//other sites link to the sections of the cases with it
+	cases := map[string]string{}
+	for cname, rel := range p.CaseToPage {
+		cases[cname] = pageFile(rel) + "#" + CaseAnchor(cname)
+	}
+
+	b, err := json.MarshalIndent(cases, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	site[SiteCasesFile] = b
+	return site, nil
+}
+
+// Renders the parsed pages and writes them to a directory
+func (p *Markdown) WriteSite(dir string, opts SiteOptions) error {
+	site, err := p.RenderSite(opts)
+	if err != nil {
+		return err
+	}
+
+	for file, b := range site {
+		fpath := filepath.Join(dir, filepath.FromSlash(file))
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(fpath, b, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package parser_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dockpit/lang/parser"
+)
+
+func TestCaseAnchor(t *testing.T) {
+	assert.Equal(t, "case-a-single-user", parser.CaseAnchor("a single user"))
+	assert.Equal(t, "case-user-s-token-v2", parser.CaseAnchor(" User's token (v2)"))
+}
+
+func TestRenderSite(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"users.md": "# /users/:user_id\n\n## 'a single user'\n\n> pit-token responds: 'authorized'\n> notes responds: 'list notes'\n\n" +
+			"See [x](http://e.com/{{.Foo}}) and <http://e.com/{{.Bar}}>.\n\n<div>{{ .Link \"x\" \"y\" }}</div>\n\n" +
+			"### when:\n\n\tGET /users/21\n\n### then:\n\n\t200 OK\n\n\t{\"name\": \"{{ .Name }}\"}\n",
+		"notes/notes.md": "# /notes\n\n## 'list notes'\n\n> pit-token responds: 'expired'\n\n### when:\n\n\tGET /notes\n\n### then:\n\n\t200 OK\n",
+	})
+	defer os.RemoveAll(dir)
+
+	p := parser.NewMarkdown(dir)
+	_, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.TempDir("", "dockpit_site_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	err = p.WriteSite(out, parser.SiteOptions{
+		Title:    "users",
+		Docs:     map[string]string{"pit-token": "../pit-token/"},
+		DocCases: map[string]map[string]string{"pit-token": {"expired": "tokens.html#case-expired"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := ioutil.ReadFile(filepath.Join(out, "users.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := string(users)
+	assert.Contains(t, page, "<title>users: users</title>")
+	assert.Contains(t, page, `<a id="case-a-single-user" class="case-anchor" href="#case-a-single-user">#</a>`)
+	assert.NotContains(t, page, `<a href="">test</a>`)
+
+	//dependencies link to their docs, a case by the same name in this
+	//service is not the case of the dependency
+	assert.Contains(t, page, `<a href="../pit-token/">pit-token</a>`)
+	assert.Contains(t, page, `<a href="../pit-token/#case-authorized">'authorized'</a>`)
+	assert.Contains(t, page, `<a href="#">notes</a>`)
+	assert.Contains(t, page, `<a href="#">'list notes'</a>`)
+
+	//content that looks like a template is left alone
+	assert.Contains(t, page, `{&quot;name&quot;: &quot;{{ .Name }}&quot;}`)
+	assert.Contains(t, page, `<a href="http://e.com/{{.Foo}}">x</a>`)
+	assert.Contains(t, page, `<a href="http://e.com/{{.Bar}}">http://e.com/{{.Bar}}</a>`)
+	assert.Contains(t, page, `<div>{{ .Link "x" "y" }}</div>`)
+
+	index, err := ioutil.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(index), `<li id="case-list-notes"><a href="notes/notes.html#case-list-notes">list notes</a>`)
+	assert.Contains(t, string(index), `<li id="case-a-single-user"><a href="users.html#case-a-single-user">a single user</a>`)
+
+	//links from pages in folders are relative to them, listed cases are
+	//linked to their section
+	notes, err := ioutil.ReadFile(filepath.Join(out, "notes", "notes.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(notes), `<a href="../../pit-token/tokens.html#case-expired">'expired'</a>`)
+
+	cases, err := ioutil.ReadFile(filepath.Join(out, parser.SiteCasesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := map[string]string{}
+	err = json.Unmarshal(cases, &m)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a single user": "users.html#case-a-single-user", "list notes": "notes/notes.html#case-list-notes"}, m)
+}
@@ -1,11 +1,130 @@
 package parser
 
 import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
 	"github.com/dockpit/lang/manifest"
 )
 
-var ValidHTTPMethods = []string{"GET", "POST", "PUT", "DELETE"} //@todo add more
+// methods defined by RFC 7231 and RFC 5789 (PATCH), other (extension)
+// methods can be registered on a parser
+var ValidHTTPMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"}
+
+// a method is a token as defined by RFC 7230
+var MethodEX = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
 
 type Parser interface {
 	Parse() (*manifest.ManifestData, error)
 }
+
+// checks the method token format of extension methods
+func validateMethods(methods []string) error {
+	for _, m := range methods {
+		if !MethodEX.MatchString(m) {
+			return fmt.Errorf("Invalid extension method '%s', expected a token (e.g PROPFIND)", m)
+		}
+	}
+
+	return nil
+}
+
+// the standard methods followed by the extension methods
+func allMethods(extensions []string) []string {
+	return append(append([]string{}, ValidHTTPMethods...), extensions...)
+}
+
+// returns wether the input is a standard method or one of the extension methods
+func isMethod(input string, extensions []string) bool {
+	for _, m := range allMethods(extensions) {
+		if m == input {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splits a comma separated list of single-quoted names, e.g: 'a', 'b'. If
+// a part isn't quoted its offset in the input is returned, -1 otherwise
+func splitCaseNames(input string) ([]string, int) {
+	names := []string{}
+	i := 0
+	for {
+		for i < len(input) && input[i] == ' ' {
+			i++
+		}
+
+		if i >= len(input) || input[i] != '\'' {
+			return nil, i
+		}
+
+		end := strings.IndexByte(input[i+1:], '\'')
+		if end < 1 {
+			return nil, i
+		}
+
+		names = append(names, input[i+1:i+1+end])
+		i += end + 2
+
+		for i < len(input) && input[i] == ' ' {
+			i++
+		}
+
+		if i == len(input) {
+			return names, -1
+		} else if input[i] != ',' {
+			return nil, i
+		}
+
+		i++
+	}
+}
+
+// adds a dependency case unless it is already expected
+func addWhile(ws []manifest.While, w manifest.While) ([]manifest.While, bool) {
+	for _, ex := range ws {
+		if ex == w {
+			return ws, false
+		}
+	}
+
+	return append(ws, w), true
+}
+
+// adds a state to those of the provider unless it is already given
+func addGiven(gs map[string]manifest.Given, pname, sname string) bool {
+	g, ok := gs[pname]
+	if !ok {
+		gs[pname] = manifest.Given{Name: sname}
+		return true
+	}
+
+	for _, ex := range g.States() {
+		if ex == sname {
+			return false
+		}
+	}
+
+	g.Others = append(g.Others, sname)
+	gs[pname] = g
+	return true
+}
+
+// splits the query string from a request path, nil is returned
+// when the path has no query
+func splitQuery(input string) (string, url.Values, error) {
+	parts := strings.SplitN(input, "?", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return parts[0], nil, nil
+	}
+
+	q, err := url.ParseQuery(parts[1])
+	if err != nil {
+		return parts[0], nil, err
+	}
+
+	return parts[0], q, nil
+}